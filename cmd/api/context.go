@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/harryng22/moviedb/internal/data"
+)
+
+type contextKey string
+
+const (
+	userContextKey      = contextKey("user")
+	requestIDContextKey = contextKey("request_id")
+	prettyContextKey    = contextKey("pretty")
+)
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns an empty string for requests that did not pass through the requestID middleware
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
+func (app *application) contextSetPretty(r *http.Request, pretty bool) *http.Request {
+	ctx := context.WithValue(r.Context(), prettyContextKey, pretty)
+	return r.WithContext(ctx)
+}
+
+// contextGetPretty reports whether the request asked for indented JSON with ?pretty=true
+func (app *application) contextGetPretty(r *http.Request) bool {
+	pretty, _ := r.Context().Value(prettyContextKey).(bool)
+	return pretty
+}
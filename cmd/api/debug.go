@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// buildCommit is set at build time with -ldflags "-X main.buildCommit=$(git rev-parse --short HEAD)"
+var buildCommit string
+
+// buildVersion appends the commit the binary was built from to the version, falling back
+// to the VCS revision stamped by the Go toolchain when no commit was passed in
+func buildVersion() string {
+	commit := buildCommit
+
+	if commit == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" {
+					commit = setting.Value
+					break
+				}
+			}
+		}
+	}
+
+	if commit == "" {
+		return version
+	}
+
+	return version + "-" + commit
+}
+
+func (app *application) debugVarsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := app.db.Stats()
+
+	// Only settings without credentials are reported
+	env := envelope{
+		"version":    buildVersion(),
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"database": map[string]interface{}{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		},
+		"config": map[string]interface{}{
+			"port":                    app.config.Port,
+			"env":                     app.config.Env,
+			"db_max_open_conns":       app.config.DbMaxOpenConns,
+			"db_max_idle_conns":       app.config.DbMaxIdleConns,
+			"db_max_idle_time":        app.config.DbMaxIdleTime,
+			"db_timeout":              app.config.DbTimeout,
+			"db_batch_timeout":        app.config.DbBatchTimeout,
+			"db_retries":              app.config.DbRetries,
+			"slow_query_threshold":    app.config.SlowQueryThreshold,
+			"read_timeout":            app.config.ReadTimeout,
+			"read_header_timeout":     app.config.ReadHeaderTimeout,
+			"write_timeout":           app.config.WriteTimeout,
+			"idle_timeout":            app.config.IdleTimeout,
+			"max_header_bytes":        app.config.MaxHeaderBytes,
+			"limiter_rps":             app.config.LimiterRps,
+			"limiter_burst":           app.config.LimiterBurst,
+			"limiter_enabled":         app.config.LimiterEnabled,
+			"limiter_store":           app.config.LimiterStore,
+			"redis_addr":              app.config.RedisAddr,
+			"metrics_enabled":         app.config.MetricsEnabled,
+			"cors_trusted_origins":    app.config.CorsTrustedOrigins,
+			"cors_max_age":            app.config.CorsMaxAge,
+			"cors_allow_credentials":  app.config.CorsAllowCredentials,
+			"trusted_proxies":         app.config.TrustedProxies,
+			"base_url":                app.config.BaseURL,
+			"compress_min_bytes":      app.config.CompressMinBytes,
+			"pretty_json":             app.config.PrettyJSON,
+			"strict_genres":           app.config.StrictGenres,
+			"search_threshold":        app.config.SearchThreshold,
+			"uploads_dir":             app.config.UploadsDir,
+			"poster_max_bytes":        app.config.PosterMaxBytes,
+			"cache_enabled":           app.config.CacheEnabled,
+			"movie_cache_size":        app.config.MovieCacheSize,
+			"dashboard_cache_ttl":     app.config.DashboardCacheTTL,
+			"stream_max_subscribers":  app.config.StreamMaxSubscribers,
+			"import_max_rows":         app.config.ImportMaxRows,
+			"import_max_bytes":        app.config.ImportMaxBytes,
+			"page_size_default":       app.config.PageSizeDefault,
+			"page_size_max":           app.config.PageSizeMax,
+			"feature_disabled_status": app.config.FeatureDisabledStatus,
+		},
+		"disabled_features": app.features.Disabled(),
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,32 +1,50 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/harryng22/moviedb/internal/validator"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
-		"request_method": r.Method,
-		"request_url":    r.URL.String(),
-	})
+	app.logger.Error("request failed",
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"request_id", app.contextGetRequestID(r),
+		"client_ip", app.realIP(r),
+		"error", err,
+	)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"error": message}
 
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
 	}
 }
 
+// serverErrorResponse hides the cause of the error from clients, except in development
+// where it is added as the debug field
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+
+	env := envelope{"error": message}
+	if app.config.Env == "development" {
+		env["debug"] = err.Error()
+	}
+
+	err = app.writeJSON(w, r, http.StatusInternalServerError, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -34,20 +52,137 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 
-func (app *application) methodNotAllowedResonse(w http.ResponseWriter, r *http.Request) {
+// moviesNotFoundResponse is the 404 of a request naming several movies, it lists the missing ids
+func (app *application) moviesNotFoundResponse(w http.ResponseWriter, r *http.Request, ids []int64) {
+	env := envelope{"error": "the requested resource could not be found", "missing_ids": ids}
+
+	err := app.writeJSON(w, r, http.StatusNotFound, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// methodNotAllowedResponse expects the Allow header to be set already, httprouter sets it
+// before calling its MethodNotAllowed handler
+func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		app.payloadTooLargeResponse(w, r, maxBytesError.Limit)
+		return
+	}
+
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+// failedValidationResponse reports every field error with its code and message, clients
+// still expecting the flat field to message map can ask for it with the X-Error-Format header
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	if wantsFlatErrors(r) {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, v.Errors)
+		return
+	}
+
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, v.Details())
+}
+
+func (app *application) failedBatchValidationResponse(w http.ResponseWriter, r *http.Request, validators map[string]*validator.Validator) {
+	flat := wantsFlatErrors(r)
+	errors := make(map[string]interface{}, len(validators))
+
+	for index, v := range validators {
+		if flat {
+			errors[index] = v.Errors
+		} else {
+			errors[index] = v.Details()
+		}
+	}
+
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// wantsFlatErrors reports whether the client asked for the legacy validation error format,
+// either with the X-Error-Format header or the error_format query parameter
+func wantsFlatErrors(r *http.Request) bool {
+	return r.Header.Get("X-Error-Format") == "flat" || r.URL.Query().Get("error_format") == "flat"
+}
+
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	message := fmt.Sprintf("the request body must not be larger than %d bytes", maxBytes)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+// movieExistsResponse answers a conditional create with the Location of the movie that
+// already has the external id
+func (app *application) movieExistsResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	w.Header().Set("Location", app.resourceURL(fmt.Sprintf("/v1/movies/%d", id)))
+
+	message := "a movie with this external id already exists"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last fetched"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) maintenanceResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "300")
+
+	message := "service under maintenance"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) featureDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this feature is currently disabled"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) tooManySubscribersResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "30")
+
+	message := "too many open streams, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
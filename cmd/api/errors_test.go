@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerErrorResponseLogsRequestProperties(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	handler := app.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.serverErrorResponse(w, r, errors.New("connection refused"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies?title=heat", nil)
+	r.Header.Set("X-Request-ID", "req-42")
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	var line map[string]string
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line), logs.String())
+
+	delete(line, "time")
+	assert.Equal(t, map[string]string{
+		"level":      "ERROR",
+		"msg":        "request failed",
+		"method":     "GET",
+		"uri":        "/v1/movies?title=heat",
+		"request_id": "req-42",
+		"client_ip":  "192.0.2.1",
+		"error":      "connection refused",
+	}, line)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/harryng22/moviedb/internal/data"
+)
+
+func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	app.setFavorite(w, r, true)
+}
+
+func (app *application) removeFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	app.setFavorite(w, r, false)
+}
+
+// setFavorite favorites or unfavorites the movie for the authenticated user, repeating
+// either request changes nothing. The response carries the new favorite count.
+func (app *application) setFavorite(w http.ResponseWriter, r *http.Request, favorite bool) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Favorited movie must exist
+	_, err = app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if favorite {
+		err = app.model.Favorite.Add(user.ID, id)
+	} else {
+		err = app.model.Favorite.Remove(user.ID, id)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	count, err := app.model.Favorite.CountForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie_id": id, "is_favorite": favorite, "favorite_count": count}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// knownFeatures are the names accepted by -disable-feature and DISABLED_FEATURES, each
+// switches off the routes wrapped with requireFeature under that name
+var knownFeatures = []string{"bulk", "export", "graphql", "import", "stats"}
+
+// featureFlags is the registry of the features switched off at startup
+type featureFlags struct {
+	disabled map[string]bool
+
+	// status is answered by the routes of a disabled feature, 404 or 503
+	status int
+}
+
+func newFeatureFlags(names []string, status int) (*featureFlags, error) {
+	if status != http.StatusNotFound && status != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("FEATURE_DISABLED_STATUS must be 404 or 503, got %d", status)
+	}
+
+	flags := &featureFlags{disabled: make(map[string]bool), status: status}
+
+	for _, name := range names {
+		if !validator.In(name, knownFeatures...) {
+			return nil, fmt.Errorf("unknown feature %q, expected one of %s", name, strings.Join(knownFeatures, ", "))
+		}
+
+		flags.disabled[name] = true
+	}
+
+	return flags, nil
+}
+
+// Enabled reports whether the routes of the feature are served, every feature is
+// enabled when no registry was set up
+func (f *featureFlags) Enabled(name string) bool {
+	return f == nil || !f.disabled[name]
+}
+
+// Disabled returns the names of the disabled features in order
+func (f *featureFlags) Disabled() []string {
+	names := []string{}
+
+	if f == nil {
+		return names
+	}
+
+	for name := range f.disabled {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// featureList collects a flag given several times, such as -disable-feature export -disable-feature stats
+type featureList []string
+
+func (l *featureList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *featureList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFeatureFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		status  int
+		wantErr string
+	}{
+		{name: "none disabled", status: http.StatusNotFound},
+		{name: "known features", names: []string{"stats", "export"}, status: http.StatusServiceUnavailable},
+		{name: "unknown feature", names: []string{"search"}, status: http.StatusNotFound, wantErr: `unknown feature "search", expected one of bulk, export, graphql, import, stats`},
+		{name: "unsupported status", status: http.StatusForbidden, wantErr: "FEATURE_DISABLED_STATUS must be 404 or 503, got 403"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newFeatureFlags(tt.names, tt.status)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFeatureFlagsDisabled(t *testing.T) {
+	features, err := newFeatureFlags([]string{"stats", "export", "stats"}, http.StatusNotFound)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"export", "stats"}, features.Disabled())
+	assert.False(t, features.Enabled("stats"))
+	assert.True(t, features.Enabled("graphql"))
+
+	var unset *featureFlags
+	assert.True(t, unset.Enabled("stats"))
+	assert.Empty(t, unset.Disabled())
+}
+
+func TestRequireFeature(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   []string
+		status     int
+		wantStatus int
+		wantError  string
+	}{
+		{name: "enabled", disabled: []string{"export"}, status: http.StatusNotFound, wantStatus: http.StatusOK},
+		{name: "disabled not found", disabled: []string{"stats"}, status: http.StatusNotFound, wantStatus: http.StatusNotFound, wantError: "the requested resource could not be found"},
+		{name: "disabled unavailable", disabled: []string{"stats"}, status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantError: "this feature is currently disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			features, err := newFeatureFlags(tt.disabled, tt.status)
+			require.NoError(t, err)
+			app.features = features
+
+			insertTestMovie(t, app, "Gladiator", 2000, 155, "action")
+
+			rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/genres/stats", ""))
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantError != "" {
+				var response struct {
+					Error string `json:"error"`
+				}
+				decodeJSON(t, rr, &response)
+				assert.Equal(t, tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestOpenAPIReportsDisabledFeatures(t *testing.T) {
+	app := newTestApplication(t)
+
+	features, err := newFeatureFlags([]string{"stats", "graphql"}, http.StatusNotFound)
+	require.NoError(t, err)
+	app.features = features
+
+	rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/openapi.json", ""))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var spec struct {
+		Info struct {
+			DisabledFeatures []string `json:"x-disabled-features"`
+		} `json:"info"`
+	}
+	decodeJSON(t, rr, &spec)
+
+	assert.Equal(t, []string{"graphql", "stats"}, spec.Info.DisabledFeatures)
+}
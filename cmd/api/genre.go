@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.model.Genre.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) genreStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	minCount := app.readInt(r.URL.Query(), "min_count", 1, v)
+
+	if v.CheckCode(minCount >= 1, "min_count", validator.CodeOutOfRange, "must be greater than zero"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	stats, err := app.model.Movie.GenreCounts(minCount)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) renameGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateGenreRename(v, input.From, input.To); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	updated, err := app.model.Movie.RenameGenre(input.From, input.To)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"updated": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
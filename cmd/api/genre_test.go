@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenreStats(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+	insertTestMovie(t, app, "The Matrix", 1999, 136, "action", "sci-fi")
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime", "drama")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantStats  map[string]int
+	}{
+		{name: "every genre", target: "/v1/genres/stats", wantStatus: http.StatusOK, wantStats: map[string]int{"action": 2, "drama": 2, "sci-fi": 1, "crime": 1}},
+		{name: "min count", target: "/v1/genres/stats?min_count=2", wantStatus: http.StatusOK, wantStats: map[string]int{"action": 2, "drama": 2}},
+		{name: "invalid min count", target: "/v1/genres/stats?min_count=0", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, tt.target, ""))
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Stats map[string]int `json:"stats"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.Equal(t, tt.wantStats, response.Stats)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// The GraphQL endpoint is read-only:
+//
+//	type Query {
+//		movie(id: Int!): Movie
+//		movies(title: String, genres: [String], page: Int, pageSize: Int, sort: String): [Movie]
+//	}
+//
+//	type Movie { id: Int, title: String, year: Int, runtime: String, genres: [String], version: Int }
+
+var graphQLMovieType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Movie",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:    graphql.Int,
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return movie.ID }),
+		},
+		"title": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return movie.Title }),
+		},
+		"year": &graphql.Field{
+			Type:    graphql.Int,
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return movie.Year }),
+		},
+		"runtime": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return fmt.Sprintf("%d mins", movie.Runtime) }),
+		},
+		"genres": &graphql.Field{
+			Type:    graphql.NewList(graphql.String),
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return movie.Genres }),
+		},
+		"version": &graphql.Field{
+			Type:    graphql.Int,
+			Resolve: resolveMovieField(func(movie *data.Movie) interface{} { return movie.Version }),
+		},
+	},
+})
+
+func resolveMovieField(fn func(movie *data.Movie) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		movie, ok := p.Source.(*data.Movie)
+		if !ok {
+			return nil, nil
+		}
+
+		return fn(movie), nil
+	}
+}
+
+// graphQLServerError wraps failures that must become a 500 instead of a GraphQL error
+type graphQLServerError struct {
+	err error
+}
+
+func (e *graphQLServerError) Error() string {
+	return e.err.Error()
+}
+
+// graphQLSchema builds the schema whose resolvers read the movies of app. The schema is
+// static, so it panics on an error like regexp.MustCompile.
+func (app *application) graphQLSchema() graphql.Schema {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"movie": &graphql.Field{
+				Type: graphQLMovieType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: app.resolveGraphQLMovie,
+			},
+			"movies": &graphql.Field{
+				Type: graphql.NewList(graphQLMovieType),
+				Args: graphql.FieldConfigArgument{
+					"title":    &graphql.ArgumentConfig{Type: graphql.String},
+					"genres":   &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String)},
+					"page":     &graphql.ArgumentConfig{Type: graphql.Int},
+					"pageSize": &graphql.ArgumentConfig{Type: graphql.Int},
+					"sort":     &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: app.resolveGraphQLMovies,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+func (app *application) resolveGraphQLMovie(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(int)
+
+	movie, err := app.model.Movie.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, &graphQLServerError{err}
+		}
+	}
+
+	return movie, nil
+}
+
+func (app *application) resolveGraphQLMovies(p graphql.ResolveParams) (interface{}, error) {
+	filter := data.Filter{
+		Page:         1,
+		PageSize:     app.config.PageSizeDefault,
+		MaxPageSize:  app.config.PageSizeMax,
+		Sort:         "id",
+		SortSafeList: []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"},
+		GenresMatch:  "all",
+	}
+
+	title, _ := p.Args["title"].(string)
+
+	var genres []string
+	if list, ok := p.Args["genres"].([]interface{}); ok {
+		for _, genre := range list {
+			if s, ok := genre.(string); ok {
+				genres = append(genres, s)
+			}
+		}
+	}
+
+	if page, ok := p.Args["page"].(int); ok {
+		filter.Page = page
+	}
+	if pageSize, ok := p.Args["pageSize"].(int); ok {
+		filter.PageSize = pageSize
+	}
+	if sort, ok := p.Args["sort"].(string); ok {
+		filter.Sort = sort
+	}
+
+	v := validator.New()
+	if data.ValidateFilter(v, filter); !v.Valid() {
+		for key, message := range v.Errors {
+			return nil, fmt.Errorf("argument %s %s", key, message)
+		}
+	}
+
+	movies, _, err := app.model.Movie.GetAll(title, genres, filter)
+	if err != nil {
+		return nil, &graphQLServerError{err}
+	}
+
+	return movies, nil
+}
+
+// graphQLHandler answers queries with the schema it builds once, mutations are rejected
+// since the schema has no Mutation type
+func (app *application) graphQLHandler() http.HandlerFunc {
+	schema := app.graphQLSchema()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  input.Query,
+			VariableValues: input.Variables,
+			OperationName:  input.OperationName,
+			Context:        r.Context(),
+		})
+
+		for _, resultErr := range result.Errors {
+			var serverErr *graphQLServerError
+			if errors.As(resultErr.OriginalError(), &serverErr) {
+				app.serverErrorResponse(w, r, serverErr.err)
+				return
+			}
+		}
+
+		env := envelope{"data": result.Data}
+		if len(result.Errors) > 0 {
+			env["errors"] = result.Errors
+		}
+
+		err = app.writeJSON(w, r, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
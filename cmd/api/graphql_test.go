@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLMovie(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	tests := []struct {
+		name     string
+		body     string
+		wantJSON string
+	}{
+		{
+			name:     "selected fields",
+			body:     `{"query":"{ movie(id: 1) { title runtime genres } }"}`,
+			wantJSON: `{"data":{"movie":{"title":"Gladiator","runtime":"155 mins","genres":["action","drama"]}}}`,
+		},
+		{
+			name:     "variables",
+			body:     `{"query":"query Show($id: Int!) { movie(id: $id) { id year } }","variables":{"id":1}}`,
+			wantJSON: `{"data":{"movie":{"id":1,"year":2000}}}`,
+		},
+		{
+			name:     "missing",
+			body:     `{"query":"{ movie(id: 42) { title } }"}`,
+			wantJSON: `{"data":{"movie":null}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/graphql", tt.body))
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.JSONEq(t, tt.wantJSON, rr.Body.String())
+		})
+	}
+}
+
+func TestGraphQLMovies(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+	insertTestMovie(t, app, "The Matrix", 1999, 136, "action", "sci-fi")
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/graphql", `{"query":"{ movies(genres: [\"drama\"], sort: \"-year\") { title } }"}`))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"data":{"movies":[{"title":"Gladiator"},{"title":"Heat"}]}}`, rr.Body.String())
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "unknown field", body: `{"query":"{ movie(id: 1) { director } }"}`},
+		{name: "missing argument", body: `{"query":"{ movie { title } }"}`},
+		{name: "mutation", body: `{"query":"mutation { deleteMovie(id: 1) }"}`},
+		{name: "invalid filter", body: `{"query":"{ movies(pageSize: 0) { title } }"}`},
+		{name: "syntax", body: `{"query":"{ movie(id: 1) { title "}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/graphql", tt.body))
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response struct {
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.NotEmpty(t, response.Errors)
+		})
+	}
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"time"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	status := http.StatusOK
 	data := envelope{
-		"status": "available",
+		"status":   "available",
+		"database": "up",
 		"system_info": map[string]string{
 			"environment": app.config.Env,
-			"version":     version,
+			"version":     buildVersion(),
 		},
 	}
 
-	err := app.writeJSON(w, http.StatusOK, data, nil)
+	// Report degraded when the database cannot be reached
+	err := app.db.PingContext(ctx)
+	if err != nil {
+		app.logError(r, err)
+
+		status = http.StatusServiceUnavailable
+		data["status"] = "degraded"
+		data["database"] = "down"
+	}
+
+	err = app.writeJSON(w, r, status, data, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
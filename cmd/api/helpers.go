@@ -1,15 +1,19 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/harryng22/moviedb/internal/data"
 	"github.com/harryng22/moviedb/internal/validator"
@@ -28,27 +32,165 @@ func (app *application) readIdParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// requestURL returns the absolute URL the client used for the request, under BASE_URL
+// when it is configured
+func (app *application) requestURL(r *http.Request) url.URL {
+	u := *r.URL
+
+	if app.config.BaseURL != "" {
+		// BASE_URL is validated at startup
+		base, _ := url.Parse(app.config.BaseURL)
+
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+		u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+		u.RawPath = ""
+
+		return u
+	}
+
+	u.Scheme = "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		u.Scheme = "https"
+	}
+
+	u.Host = r.Host
+
+	return u
+}
+
+// resourceURL prefixes the path of a resource with BASE_URL, the path is returned
+// as is when no base URL is configured
+func (app *application) resourceURL(path string) string {
+	return strings.TrimSuffix(app.config.BaseURL, "/") + path
+}
+
 type envelope map[string]interface{}
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.Marshal(data)
+// writeJSON sends the envelope compact, or indented with PRETTY_JSON and for a request
+// with ?pretty=true
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	js, err := marshalJSON(data, app.contextGetPretty(r) || app.config.PrettyJSON)
 	if err != nil {
 		return err
 	}
 
-	js = append(js, '\n')
-
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
 	w.WriteHeader(status)
 	w.Write(js)
 
 	return nil
 }
 
+// marshalJSON encodes the envelope followed by a newline, indented by two spaces when pretty
+func marshalJSON(data envelope, pretty bool) ([]byte, error) {
+	var (
+		js  []byte
+		err error
+	)
+
+	if pretty {
+		js, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		js, err = json.Marshal(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(js, '\n'), nil
+}
+
+// MarshalXML writes the envelope as a <response> element with one child element per key
+func (e envelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "response"
+
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err = enc.EncodeElement(e[key], xml.StartElement{Name: xml.Name{Local: key}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func (app *application) writeXML(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	x, err := xml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	x = append([]byte(xml.Header), x...)
+	x = append(x, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(x)
+
+	return nil
+}
+
+// writeResponse writes XML when the Accept header asks for it and JSON otherwise
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	w.Header().Add("Vary", "Accept")
+
+	accept := r.Header.Get("Accept")
+
+	if strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml") {
+		return app.writeXML(w, status, data, headers)
+	}
+
+	return app.writeJSON(w, r, status, data, headers)
+}
+
+// writeMinimal honours "Prefer: return=minimal" by sending only the status and headers,
+// it reports whether the response was written so the caller can skip the full body
+func (app *application) writeMinimal(w http.ResponseWriter, r *http.Request, status int, headers http.Header) bool {
+	minimal := false
+
+	for _, preference := range strings.Split(strings.Join(r.Header.Values("Prefer"), ","), ",") {
+		if strings.EqualFold(strings.TrimSpace(preference), "return=minimal") {
+			minimal = true
+			break
+		}
+	}
+
+	if !minimal {
+		return false
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Preference-Applied", "return=minimal")
+	w.Header().Add("Vary", "Prefer")
+	w.WriteHeader(status)
+
+	return true
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -60,6 +202,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
 
 		switch {
 		case errors.As(err, &syntaxError):
@@ -81,8 +224,9 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		// Hand the MaxBytesError back unchanged so badRequestResponse can turn it into a 413
+		case errors.As(err, &maxBytesError):
+			return maxBytesError
 
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
@@ -111,13 +255,29 @@ func (app *application) readString(queryString url.Values, key, defaultValue str
 }
 
 func (app *application) readCSV(queryString url.Values, key string, defaultValue []string) []string {
-	csv := queryString.Get(key)
+	return app.readDelimited(queryString, key, ",", defaultValue)
+}
+
+func (app *application) readDelimited(queryString url.Values, key, delim string, defaultValue []string) []string {
+	list := queryString.Get(key)
 
-	if csv == "" {
+	if list == "" {
 		return defaultValue
 	}
 
-	return strings.Split(csv, ",")
+	return strings.Split(list, delim)
+}
+
+// readGenres reads the genres list separated by genres_delim, one of "," (the default), "|" or ";"
+func (app *application) readGenres(queryString url.Values, v *validator.Validator) []string {
+	delim := app.readString(queryString, "genres_delim", ",")
+
+	if !validator.In(delim, ",", "|", ";") {
+		v.AddErrorCode("genres_delim", validator.CodeInvalid, `must be one of ",", "|" or ";"`)
+		delim = ","
+	}
+
+	return app.readDelimited(queryString, "genres", delim, []string{})
 }
 
 func (app *application) readInt(queryString url.Values, key string, defaultValue int, v *validator.Validator) int {
@@ -128,20 +288,227 @@ func (app *application) readInt(queryString url.Values, key string, defaultValue
 
 	intValue, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddErrorCode(key, validator.CodeInvalidFormat, "must be an integer value")
 		return defaultValue
 	}
 
 	return intValue
 }
 
+// fieldSet holds the selected JSON keys of a record
+type fieldSet map[string]json.RawMessage
+
+func (f fieldSet) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value interface{}
+
+		err = json.Unmarshal(f[key], &value)
+		if err != nil {
+			return err
+		}
+
+		err = enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: key}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func (app *application) readDate(queryString url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := queryString.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	date, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddErrorCode(key, validator.CodeInvalidFormat, "must be an RFC3339 timestamp")
+		return defaultValue
+	}
+
+	return date
+}
+
+// readRuntimeFormat reads how movie runtimes should be marshaled, "mins" or "iso8601"
+func (app *application) readRuntimeFormat(queryString url.Values, v *validator.Validator) string {
+	format := app.readString(queryString, "runtime_format", data.RuntimeFormatMins)
+
+	v.CheckCode(validator.In(format, data.RuntimeFormatMins, data.RuntimeFormatISO8601), "runtime_format", validator.CodeInvalid, "must be either mins or iso8601")
+
+	return format
+}
+
+// readPagination reads page and page_size for sub-resource listings, those come in a
+// fixed order so there is no sort to choose
+func (app *application) readPagination(queryString url.Values, v *validator.Validator) data.Filter {
+	return data.Filter{
+		Page:         app.readInt(queryString, "page", 1, v),
+		PageSize:     app.readInt(queryString, "page_size", app.config.PageSizeDefault, v),
+		MaxPageSize:  app.config.PageSizeMax,
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+}
+
+// selectFields marshals a slice of records and keeps only the given JSON keys of each one
+func selectFields(records interface{}, fields []string) ([]fieldSet, error) {
+	js, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []fieldSet
+
+	err = json.Unmarshal(js, &selected)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range selected {
+		for key := range record {
+			if !validator.In(key, fields...) {
+				delete(record, key)
+			}
+		}
+	}
+
+	return selected, nil
+}
+
+// movieETag identifies a movie revision by its id and version
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`W/"%d-%d"`, movie.ID, movie.Version)
+}
+
+// movieDetailETag identifies the movie detail of showMovieHandler, which also carries the
+// ratings, cast and favorites of the movie and the watchlist of the user. It starts with
+// the id and version, so it still names the revision in an If-Match.
+func movieDetailETag(movie *data.Movie, env envelope) (string, error) {
+	js, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(js)
+
+	return fmt.Sprintf(`W/"%d-%d-%x"`, movie.ID, movie.Version, hash[:8]), nil
+}
+
+// matchesMovieRevision reports whether a comma separated If-Match header names the
+// revision of the movie, with its movieETag or any movieDetailETag of that revision
+func matchesMovieRevision(header string, movie *data.Movie) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		value := strings.Trim(strings.TrimPrefix(strings.TrimSpace(candidate), "W/"), `"`)
+
+		if value == "*" || value == fmt.Sprintf("%d-%d", movie.ID, movie.Version) || strings.HasPrefix(value, fmt.Sprintf("%d-%d-", movie.ID, movie.Version)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIfMatchVersion reads the expected movie version of an If-Match header, either
+// the bare version number or an ETag of the movie as sent by showMovieHandler
+func parseIfMatchVersion(header string, id int64) (int64, error) {
+	value := strings.Trim(strings.TrimPrefix(strings.TrimSpace(header), "W/"), `"`)
+
+	if prefix := strconv.FormatInt(id, 10) + "-"; strings.HasPrefix(value, prefix) {
+		value = strings.TrimPrefix(value, prefix)
+
+		// The detail ETag ends with a hash of the response after the version
+		value, _, _ = strings.Cut(value, "-")
+	}
+
+	version, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("If-Match header must be the movie version or its ETag")
+	}
+
+	return version, nil
+}
+
+// etagMatches reports whether a comma separated If-Match/If-None-Match header contains the etag
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
 type Config struct {
-	Port           int    `mapstructure:"PORT"`
-	Env            string `mapstructure:"ENV"`
-	DbDsn          string `mapstructure:"DB_DSN"`
-	DbMaxOpenConns int    `mapstructure:"DB_MAX_OPEN_CONNS"`
-	DbMaxIdleConns int    `mapstructure:"DB_MAX_IDLE_CONNS"`
-	DbMaxIdleTime  string `mapstructure:"DB_MAX_IDLE_TIME"`
+	Port                  int     `mapstructure:"PORT"`
+	Env                   string  `mapstructure:"ENV"`
+	DbDsn                 string  `mapstructure:"DB_DSN"`
+	DbMaxOpenConns        int     `mapstructure:"DB_MAX_OPEN_CONNS"`
+	DbMaxIdleConns        int     `mapstructure:"DB_MAX_IDLE_CONNS"`
+	DbMaxIdleTime         string  `mapstructure:"DB_MAX_IDLE_TIME"`
+	DbTimeout             string  `mapstructure:"DB_TIMEOUT"`
+	DbBatchTimeout        string  `mapstructure:"DB_BATCH_TIMEOUT"`
+	DbRetries             int     `mapstructure:"DB_RETRIES"`
+	SlowQueryThreshold    string  `mapstructure:"SLOW_QUERY_THRESHOLD"`
+	ReadTimeout           string  `mapstructure:"READ_TIMEOUT"`
+	ReadHeaderTimeout     string  `mapstructure:"READ_HEADER_TIMEOUT"`
+	WriteTimeout          string  `mapstructure:"WRITE_TIMEOUT"`
+	IdleTimeout           string  `mapstructure:"IDLE_TIMEOUT"`
+	MaxHeaderBytes        int     `mapstructure:"MAX_HEADER_BYTES"`
+	TlsCert               string  `mapstructure:"TLS_CERT"`
+	TlsKey                string  `mapstructure:"TLS_KEY"`
+	LimiterRps            float64 `mapstructure:"LIMITER_RPS"`
+	LimiterBurst          int     `mapstructure:"LIMITER_BURST"`
+	LimiterEnabled        bool    `mapstructure:"LIMITER_ENABLED"`
+	LimiterStore          string  `mapstructure:"LIMITER_STORE"`
+	RedisAddr             string  `mapstructure:"REDIS_ADDR"`
+	MetricsEnabled        bool    `mapstructure:"METRICS_ENABLED"`
+	CorsTrustedOrigins    string  `mapstructure:"CORS_TRUSTED_ORIGINS"`
+	CorsMaxAge            string  `mapstructure:"CORS_MAX_AGE"`
+	CorsAllowCredentials  bool    `mapstructure:"CORS_ALLOW_CREDENTIALS"`
+	TrustedProxies        string  `mapstructure:"TRUSTED_PROXIES"`
+	BaseURL               string  `mapstructure:"BASE_URL"`
+	CompressMinBytes      int     `mapstructure:"COMPRESS_MIN_BYTES"`
+	PrettyJSON            bool    `mapstructure:"PRETTY_JSON"`
+	StrictGenres          bool    `mapstructure:"STRICT_GENRES"`
+	SearchThreshold       float64 `mapstructure:"SEARCH_THRESHOLD"`
+	SmtpHost              string  `mapstructure:"SMTP_HOST"`
+	SmtpPort              int     `mapstructure:"SMTP_PORT"`
+	SmtpUsername          string  `mapstructure:"SMTP_USERNAME"`
+	SmtpPassword          string  `mapstructure:"SMTP_PASSWORD"`
+	SmtpSender            string  `mapstructure:"SMTP_SENDER"`
+	UploadsDir            string  `mapstructure:"UPLOADS_DIR"`
+	PosterMaxBytes        int64   `mapstructure:"POSTER_MAX_BYTES"`
+	CacheEnabled          bool    `mapstructure:"CACHE_ENABLED"`
+	MovieCacheSize        int     `mapstructure:"MOVIE_CACHE_SIZE"`
+	DashboardCacheTTL     string  `mapstructure:"DASHBOARD_CACHE_TTL"`
+	PageSizeDefault       int     `mapstructure:"PAGE_SIZE_DEFAULT"`
+	PageSizeMax           int     `mapstructure:"PAGE_SIZE_MAX"`
+	Maintenance           bool    `mapstructure:"MAINTENANCE"`
+	ImportMaxRows         int     `mapstructure:"IMPORT_MAX_ROWS"`
+	ImportMaxBytes        int64   `mapstructure:"IMPORT_MAX_BYTES"`
+	StreamMaxSubscribers  int     `mapstructure:"STREAM_MAX_SUBSCRIBERS"`
+	DisabledFeatures      string  `mapstructure:"DISABLED_FEATURES"`
+	FeatureDisabledStatus int     `mapstructure:"FEATURE_DISABLED_STATUS"`
 }
 
 func LoadConfig(filePath string) (config Config, err error) {
@@ -149,6 +516,50 @@ func LoadConfig(filePath string) (config Config, err error) {
 	viper.SetConfigName(filepath.Base(filePath))
 	viper.SetConfigType(strings.TrimPrefix(filepath.Ext(filePath), "."))
 
+	viper.SetDefault("ENV", "production")
+
+	// Sensible pool defaults, operators can override them in the config file or environment
+	viper.SetDefault("DB_MAX_OPEN_CONNS", 25)
+	viper.SetDefault("DB_MAX_IDLE_CONNS", 25)
+	viper.SetDefault("DB_MAX_IDLE_TIME", "15m")
+	viper.SetDefault("DB_TIMEOUT", "3s")
+	viper.SetDefault("DB_BATCH_TIMEOUT", "10s")
+	viper.SetDefault("DB_RETRIES", 3)
+	viper.SetDefault("SLOW_QUERY_THRESHOLD", "500ms")
+
+	// The write timeout must stay above DB_TIMEOUT and DB_BATCH_TIMEOUT, otherwise a slow
+	// query can outlive the connection and the client never receives the error response
+	viper.SetDefault("READ_TIMEOUT", "10s")
+	viper.SetDefault("READ_HEADER_TIMEOUT", "5s")
+	viper.SetDefault("WRITE_TIMEOUT", "30s")
+	viper.SetDefault("IDLE_TIMEOUT", "1m")
+	viper.SetDefault("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes)
+	viper.SetDefault("TLS_CERT", "")
+	viper.SetDefault("TLS_KEY", "")
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("BASE_URL", "")
+	viper.SetDefault("CORS_MAX_AGE", "0s")
+	viper.SetDefault("CORS_ALLOW_CREDENTIALS", false)
+	viper.SetDefault("PRETTY_JSON", false)
+	viper.SetDefault("LIMITER_STORE", "memory")
+	viper.SetDefault("REDIS_ADDR", "")
+
+	viper.SetDefault("UPLOADS_DIR", "./uploads")
+	viper.SetDefault("POSTER_MAX_BYTES", 5_242_880)
+
+	viper.SetDefault("CACHE_ENABLED", false)
+	viper.SetDefault("MOVIE_CACHE_SIZE", 1000)
+	viper.SetDefault("DASHBOARD_CACHE_TTL", "1m")
+	viper.SetDefault("STREAM_MAX_SUBSCRIBERS", 100)
+	viper.SetDefault("IMPORT_MAX_ROWS", 10000)
+	viper.SetDefault("IMPORT_MAX_BYTES", 10_485_760)
+	viper.SetDefault("MAINTENANCE", false)
+	viper.SetDefault("DISABLED_FEATURES", "")
+	viper.SetDefault("FEATURE_DISABLED_STATUS", http.StatusNotFound)
+	viper.SetDefault("PAGE_SIZE_DEFAULT", 20)
+	viper.SetDefault("PAGE_SIZE_MAX", 100)
+	viper.SetDefault("SEARCH_THRESHOLD", 0.3)
+
 	viper.AutomaticEnv()
 
 	err = viper.ReadInConfig()
@@ -160,6 +571,64 @@ func LoadConfig(filePath string) (config Config, err error) {
 	return
 }
 
+func validateInputPresence(v *validator.Validator, input Input) {
+	v.Check(input.Title != nil, "title", "must be provided")
+	v.Check(input.Year != nil, "year", "must be provided")
+	v.Check(input.Runtime != nil, "runtime", "must be provided")
+	v.Check(input.Genres.Set, "genres", "must be provided")
+}
+
+// validateUpdatedMovie checks the movie after the update, only a patch may leave it without genres
+func validateUpdatedMovie(v *validator.Validator, movie *data.Movie, partial bool) {
+	if partial {
+		data.ValidatePatchedMovie(v, movie)
+		return
+	}
+
+	data.ValidateMovie(v, movie)
+}
+
+// background runs fn in a goroutine tracked by the application WaitGroup,
+// a panic inside fn is logged instead of crashing the server
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background task panicked", "error", fmt.Sprintf("%s", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// validateKnownGenres checks the genres against the canonical list unless strict genre validation is disabled
+func (app *application) validateKnownGenres(v *validator.Validator, genres []string) error {
+	if !app.config.StrictGenres || len(genres) == 0 {
+		return nil
+	}
+
+	exists, err := app.model.Genre.Exists(genres)
+	if err != nil {
+		return err
+	}
+
+	v.Check(exists, "genres", "must only contain known genres")
+
+	return nil
+}
+
+// hashInput fingerprints a decoded request body, json.Marshal of a struct is deterministic
+func hashInput(input interface{}) []byte {
+	js, _ := json.Marshal(input)
+	hash := sha256.Sum256(js)
+
+	return hash[:]
+}
 
 func copyProperties(input Input, movie *data.Movie) {
 	if input.Title != nil {
@@ -174,7 +643,11 @@ func copyProperties(input Input, movie *data.Movie) {
 		movie.Runtime = *input.Runtime
 	}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	// An explicit null clears the genres, a missing key keeps them
+	if input.Genres.Set {
+		movie.Genres = input.Genres.Value
+		if movie.Genres == nil {
+			movie.Genres = []string{}
+		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+var errTooManyImportRows = errors.New("too many rows")
+
+// importError reports a row of an imported CSV file that was not inserted
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importMoviesHandler inserts the movies of the CSV file uploaded as the "file" part of a
+// multipart form. The file is read while the movies are inserted, so it is never held in
+// memory. Its header names the title, year, runtime and genres columns, other columns such
+// as the id of an export are ignored. Genres are separated by "|".
+//
+// The import transaction stays open while the upload is read, so the request is capped
+// at IMPORT_MAX_BYTES and the transaction is rolled back once the client goes away.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.ImportMaxBytes)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must be a multipart form with a CSV file"))
+		return
+	}
+
+	var part *multipart.Part
+
+	for {
+		part, err = reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			app.badRequestResponse(w, r, errors.New("body must contain a file part"))
+			return
+		}
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if part.FormName() == "file" {
+			break
+		}
+	}
+
+	defer part.Close()
+
+	csvReader := csv.NewReader(part)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	v := validator.New()
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			v.AddError("file", "must have a header with the title, year, runtime and genres columns")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	var (
+		rows    int
+		line    int
+		readErr error
+		errs    = []importError{}
+	)
+
+	next := func() (*data.Movie, error) {
+		for {
+			record, err := csvReader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+
+			line, _ = csvReader.FieldPos(0)
+
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					errs = append(errs, importError{Line: parseErr.Line, Error: parseErr.Err.Error()})
+					continue
+				}
+
+				readErr = err
+				return nil, err
+			}
+
+			rows++
+			if rows > app.config.ImportMaxRows {
+				return nil, errTooManyImportRows
+			}
+
+			movie, v := parseImportRow(record, columns)
+
+			err = app.validateKnownGenres(v, movie.Genres)
+			if err != nil {
+				return nil, err
+			}
+
+			if !v.Valid() {
+				errs = append(errs, importError{Line: line, Error: rowErrors(v)})
+				continue
+			}
+
+			return movie, nil
+		}
+	}
+
+	rejected := func(movie *data.Movie, err error) {
+		message := "a movie with this title and year already exists"
+		if errors.Is(err, data.ErrDuplicateExternalID) {
+			message = "a movie with this external id already exists"
+		}
+
+		errs = append(errs, importError{Line: line, Error: message})
+	}
+
+	imported, err := app.model.Movie.Import(r.Context(), next, rejected)
+	if err != nil {
+		switch {
+		case errors.Is(err, errTooManyImportRows):
+			v.AddError("file", fmt.Sprintf("must not contain more than %d rows", app.config.ImportMaxRows))
+			app.failedValidationResponse(w, r, v)
+		case readErr != nil:
+			app.badRequestResponse(w, r, readErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"imported": imported, "errors": errs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// parseImportRow reads the movie of a CSV record, the cells that cannot be parsed are
+// reported in the returned validator along with the failed movie validation
+func parseImportRow(record []string, columns map[string]int) (*data.Movie, *validator.Validator) {
+	v := validator.New()
+
+	cell := func(name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	movie := &data.Movie{Title: cell("title"), Genres: []string{}}
+
+	if genres := cell("genres"); genres != "" {
+		movie.Genres = strings.Split(genres, "|")
+	}
+
+	year, yearErr := strconv.ParseInt(cell("year"), 10, 32)
+	movie.Year = int32(year)
+
+	runtime, runtimeErr := data.ParseRuntime(cell("runtime"))
+	movie.Runtime = runtime
+
+	data.ValidateMovie(v, movie)
+
+	// A cell that cannot be parsed reports that instead of the range of its zero value
+	v.CheckCode(yearErr == nil, "year", validator.CodeInvalidFormat, "must be an integer value")
+	v.CheckCode(runtimeErr == nil, "runtime", validator.CodeInvalidFormat, "must be a number of minutes")
+
+	return movie, v
+}
+
+// rowErrors joins the errors of a row in field order, such as "runtime: must be provided; year: ..."
+func rowErrors(v *validator.Validator) string {
+	fields := make([]string, 0, len(v.Errors))
+	for field := range v.Errors {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field + ": " + v.Errors[field]
+	}
+
+	return strings.Join(messages, "; ")
+}
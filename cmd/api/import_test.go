@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newImportRequest uploads csv as the file part of a multipart form to the import route
+func newImportRequest(t *testing.T, csv string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "movies.csv")
+	require.NoError(t, err)
+
+	_, err = part.Write([]byte(csv))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	r := newTestRequest(t, http.MethodPost, "/v1/movies/import", body.String())
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	return r
+}
+
+func TestImportMovies(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.ImportMaxRows = 10
+	app.config.ImportMaxBytes = 1_048_576
+
+	csv := "title,year,runtime,genres\nGladiator,2000,155,action|drama\nHeat,1995,,crime\n"
+
+	rr := serve(app, newImportRequest(t, csv))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response struct {
+		Imported int           `json:"imported"`
+		Errors   []importError `json:"errors"`
+	}
+	decodeJSON(t, rr, &response)
+
+	assert.Equal(t, 1, response.Imported)
+	assert.Equal(t, []importError{{Line: 3, Error: "runtime: must be a number of minutes"}}, response.Errors)
+}
+
+func TestImportMoviesMaxBytes(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.ImportMaxRows = 10_000
+	app.config.ImportMaxBytes = 1024
+
+	csv := "title,year,runtime,genres\n" + strings.Repeat("Gladiator,2000,155,action\n", 100)
+
+	rr := serve(app, newImportRequest(t, csv))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, rr.Body.String())
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	decodeJSON(t, rr, &response)
+	assert.Equal(t, "the request body must not be larger than 1024 bytes", response.Error)
+}
+
+func TestImportMoviesCancelled(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.ImportMaxRows = 10
+	app.config.ImportMaxBytes = 1_048_576
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := newImportRequest(t, "title,year,runtime,genres\nGladiator,2000,155,action\n").WithContext(ctx)
+
+	rr := serve(app, r)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+
+	_, err := app.model.Movie.Get(1)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// JSON:API (https://jsonapi.org) is an opt-in alternative to the envelope, clients ask
+// for it with "Accept: application/vnd.api+json"
+const jsonAPIMediaType = "application/vnd.api+json"
+
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    fieldSet                       `json:"attributes,omitempty"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+	Meta          map[string]interface{}         `json:"meta,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Data []jsonAPIResource `json:"data"`
+}
+
+type jsonAPIDocument struct {
+	Data     interface{}            `json:"data"`
+	Included []jsonAPIResource      `json:"included,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+	Links    *data.Links            `json:"links,omitempty"`
+}
+
+func wantsJSONAPI(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), jsonAPIMediaType)
+}
+
+func (app *application) writeJSONAPI(w http.ResponseWriter, status int, doc jsonAPIDocument, headers http.Header) error {
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", jsonAPIMediaType)
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// movieResource moves the id of a movie out of its attributes, fields optionally
+// restricts the attributes like the fields query parameter of the envelope format
+func movieResource(movie *data.Movie, fields []string) (jsonAPIResource, error) {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return jsonAPIResource{}, err
+	}
+
+	var attributes fieldSet
+
+	err = json.Unmarshal(js, &attributes)
+	if err != nil {
+		return jsonAPIResource{}, err
+	}
+
+	delete(attributes, "id")
+
+	if len(fields) > 0 {
+		for key := range attributes {
+			if !validator.In(key, fields...) {
+				delete(attributes, key)
+			}
+		}
+	}
+
+	return jsonAPIResource{
+		Type:       "movies",
+		ID:         strconv.FormatInt(movie.ID, 10),
+		Attributes: attributes,
+	}, nil
+}
+
+// castRelationship links the actors of a cast to the movie, the role of each actor
+// is meta of the link and the actors themselves are returned as included resources
+func castRelationship(cast []*data.CastMember) (jsonAPIRelationship, []jsonAPIResource, error) {
+	relationship := jsonAPIRelationship{Data: []jsonAPIResource{}}
+	included := []jsonAPIResource{}
+	seen := make(map[int64]bool)
+
+	for _, member := range cast {
+		id := strconv.FormatInt(member.ActorID, 10)
+
+		relationship.Data = append(relationship.Data, jsonAPIResource{
+			Type: "actors",
+			ID:   id,
+			Meta: map[string]interface{}{"role": member.Role},
+		})
+
+		// An actor playing several roles is included once
+		if seen[member.ActorID] {
+			continue
+		}
+		seen[member.ActorID] = true
+
+		name, err := json.Marshal(member.Name)
+		if err != nil {
+			return jsonAPIRelationship{}, nil, err
+		}
+
+		included = append(included, jsonAPIResource{
+			Type:       "actors",
+			ID:         id,
+			Attributes: fieldSet{"name": name},
+		})
+	}
+
+	return relationship, included, nil
+}
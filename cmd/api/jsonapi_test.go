@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowMovieJSONAPI(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	t.Run("envelope", func(t *testing.T) {
+		rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies/1", ""))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var response struct {
+			Movie data.Movie `json:"movie"`
+		}
+		decodeJSON(t, rr, &response)
+
+		assert.Equal(t, int64(1), response.Movie.ID)
+		assert.Equal(t, "Gladiator", response.Movie.Title)
+	})
+
+	t.Run("JSON:API", func(t *testing.T) {
+		r := newTestRequest(t, http.MethodGet, "/v1/movies/1", "")
+		r.Header.Set("Accept", jsonAPIMediaType)
+
+		rr := serve(app, r)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		assert.Equal(t, jsonAPIMediaType, rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Header().Values("Vary"), "Accept")
+
+		var document struct {
+			Data struct {
+				Type          string                 `json:"type"`
+				ID            string                 `json:"id"`
+				Attributes    map[string]interface{} `json:"attributes"`
+				Relationships map[string]struct {
+					Data []interface{} `json:"data"`
+				} `json:"relationships"`
+			} `json:"data"`
+		}
+		decodeJSON(t, rr, &document)
+
+		assert.Equal(t, "movies", document.Data.Type)
+		assert.Equal(t, "1", document.Data.ID)
+		assert.Equal(t, "Gladiator", document.Data.Attributes["title"])
+		assert.Equal(t, "155 mins", document.Data.Attributes["runtime"])
+		assert.NotContains(t, document.Data.Attributes, "id")
+		assert.Contains(t, document.Data.Relationships, "cast")
+	})
+}
+
+func TestListMoviesJSONAPI(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime", "drama")
+
+	t.Run("envelope", func(t *testing.T) {
+		rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies?page_size=1", ""))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var response struct {
+			Metadata data.Metadata `json:"metadata"`
+			Movies   []data.Movie  `json:"movies"`
+		}
+		decodeJSON(t, rr, &response)
+
+		require.Len(t, response.Movies, 1)
+		assert.Equal(t, 2, response.Metadata.TotalRecords)
+	})
+
+	t.Run("JSON:API", func(t *testing.T) {
+		r := newTestRequest(t, http.MethodGet, "/v1/movies?page_size=1", "")
+		r.Header.Set("Accept", jsonAPIMediaType)
+
+		rr := serve(app, r)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		assert.Equal(t, jsonAPIMediaType, rr.Header().Get("Content-Type"))
+
+		var document struct {
+			Data []struct {
+				Type       string                 `json:"type"`
+				ID         string                 `json:"id"`
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"data"`
+			Meta struct {
+				Pagination data.Metadata `json:"pagination"`
+			} `json:"meta"`
+			Links *data.Links `json:"links"`
+		}
+		decodeJSON(t, rr, &document)
+
+		require.Len(t, document.Data, 1)
+		assert.Equal(t, "movies", document.Data[0].Type)
+		assert.Equal(t, "1", document.Data[0].ID)
+		assert.Equal(t, "Gladiator", document.Data[0].Attributes["title"])
+
+		assert.Equal(t, 2, document.Meta.Pagination.TotalRecords)
+		assert.Nil(t, document.Meta.Pagination.Links)
+		assert.NotNil(t, document.Links)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// Limiter decides whether the client with the key may make another request. An error
+// means the limiter could not decide, rateLimit then lets the request through.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// memoryLimiter keeps a token bucket per client in this process, replicas do not share it
+type memoryLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*limitedClient
+	rps     float64
+	burst   int
+}
+
+type limitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newMemoryLimiter(rps float64, burst int) *memoryLimiter {
+	l := &memoryLimiter{
+		clients: make(map[string]*limitedClient),
+		rps:     rps,
+		burst:   burst,
+	}
+
+	// Evict clients that have not been seen for 3 minutes
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			l.mu.Lock()
+
+			for key, client := range l.clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(l.clients, key)
+				}
+			}
+
+			l.mu.Unlock()
+		}
+	}()
+
+	return l
+}
+
+func (l *memoryLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, found := l.clients[key]
+	if !found {
+		client = &limitedClient{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.clients[key] = client
+	}
+
+	client.lastSeen = time.Now()
+
+	return client.limiter.Allow(), nil
+}
+
+// tokenBucketScript refills the bucket of KEYS[1] by ARGV[1] tokens a second up to ARGV[2]
+// and takes a token when there is one. It reads the clock of Redis so every replica
+// refills the buckets alike, and the bucket expires once it would be full again.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+local ttl = 60000
+if rate > 0 then
+	ttl = math.ceil(burst / rate * 1000) + 1000
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], ttl)
+
+return allowed
+`)
+
+// redisLimiter keeps the token buckets in Redis, so every replica draws on the same
+// allowance of a client
+type redisLimiter struct {
+	client *redis.Client
+	rps    float64
+	burst  int
+}
+
+// newRedisLimiter connects lazily, an unreachable Redis fails the requests to Allow and
+// not the startup
+func newRedisLimiter(addr string, rps float64, burst int) *redisLimiter {
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		DialTimeout:  time.Second,
+		ReadTimeout:  200 * time.Millisecond,
+		WriteTimeout: 200 * time.Millisecond,
+	})
+
+	return &redisLimiter{client: client, rps: rps, burst: burst}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	allowed, err := tokenBucketScript.Run(ctx, l.client, []string{"ratelimit:" + key}, l.rps, l.burst).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return allowed == 1, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowN asks the limiter n times for the key and returns the answers
+func allowN(t *testing.T, l Limiter, key string, n int) []bool {
+	t.Helper()
+
+	answers := make([]bool, n)
+
+	for i := range answers {
+		allowed, err := l.Allow(context.Background(), key)
+		require.NoError(t, err)
+
+		answers[i] = allowed
+	}
+
+	return answers
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	l := newMemoryLimiter(0.001, 2)
+
+	assert.Equal(t, []bool{true, true, false}, allowN(t, l, "192.0.2.1", 3))
+	assert.Equal(t, []bool{true}, allowN(t, l, "192.0.2.2", 1))
+}
+
+func TestRedisLimiterBurst(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := newRedisLimiter(mr.Addr(), 0.001, 2)
+
+	assert.Equal(t, []bool{true, true, false}, allowN(t, l, "192.0.2.1", 3))
+	assert.Equal(t, []bool{true}, allowN(t, l, "192.0.2.2", 1))
+
+	assert.True(t, mr.Exists("ratelimit:192.0.2.1"))
+	assert.Greater(t, mr.TTL("ratelimit:192.0.2.1"), time.Duration(0))
+}
+
+func TestRedisLimiterRefill(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := newRedisLimiter(mr.Addr(), 1, 1)
+
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	assert.Equal(t, []bool{true, false}, allowN(t, l, "192.0.2.1", 2))
+
+	mr.SetTime(now.Add(500 * time.Millisecond))
+	assert.Equal(t, []bool{false}, allowN(t, l, "192.0.2.1", 1))
+
+	mr.SetTime(now.Add(time.Second))
+	assert.Equal(t, []bool{true, false}, allowN(t, l, "192.0.2.1", 2))
+}
+
+// Two replicas pointing at the same Redis share the allowance of a client
+func TestRedisLimiterSharedByReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	first := newRedisLimiter(mr.Addr(), 0.001, 2)
+	second := newRedisLimiter(mr.Addr(), 0.001, 2)
+
+	assert.Equal(t, []bool{true}, allowN(t, first, "192.0.2.1", 1))
+	assert.Equal(t, []bool{true, false}, allowN(t, second, "192.0.2.1", 2))
+	assert.Equal(t, []bool{false}, allowN(t, first, "192.0.2.1", 1))
+}
+
+func TestRateLimitRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	app := newTestApplication(t)
+	app.config.LimiterEnabled = true
+	app.limiter = newRedisLimiter(mr.Addr(), 0.001, 1)
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/movies", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/movies", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
+
+func TestRateLimitRedisUnreachable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	app.config.LimiterEnabled = true
+	app.limiter = newRedisLimiter(addr, 0.001, 1)
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/movies", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Contains(t, logs.String(), `"level":"WARN"`)
+	assert.Contains(t, logs.String(), `"msg":"rate limiter unavailable, allowing the request"`)
+}
@@ -2,66 +2,670 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/harryng22/moviedb/internal/data"
-	"github.com/harryng22/moviedb/internal/jsonlog"
+	"github.com/harryng22/moviedb/internal/mailer"
+	"github.com/harryng22/moviedb/internal/validator"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
 )
 
 const version = "1.0.0"
 
 type application struct {
 	config Config
-	logger *jsonlog.Logger
+	logger *slog.Logger
+	db     *sql.DB
 	model  data.Model
+	mailer mailer.Mailer
+	wg     sync.WaitGroup
+
+	// trustedProxies are the peers whose forwarding headers name the real client
+	trustedProxies []*net.IPNet
+
+	dashboard dashboardCache
+
+	features *featureFlags
+
+	// limiter counts the requests of each client for rateLimit
+	limiter Limiter
+
+	// movieEvents publishes the created movies to the open event streams
+	movieEvents movieHub
+
+	// logLevel is the minimum level of the logger, setting it takes effect immediately
+	logLevel *slog.LevelVar
+
+	// maintenance blocks writes to movie data, it can be flipped at runtime with SIGHUP
+	maintenance atomic.Bool
 }
 
 func main() {
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	var (
+		tlsCert, tlsKey, trustedProxies, baseURL string
+		env                                      string
+		uploadsDir                               string
+		posterMaxBytes                           int64
+		importMaxBytes                           int64
+		limiterStore, redisAddr                  string
+		limiterRps                               float64
+		limiterBurst                             int
+		limiterEnabled                           bool
+		metricsEnabled                           bool
+		corsTrustedOrigins                       string
+		strictGenres                             bool
+		smtpHost, smtpUsername, smtpPassword     string
+		smtpSender                               string
+		smtpPort                                 int
+		logFormat, logLevel                      string
+		corsMaxAge                               time.Duration
+		corsAllowCredentials, prettyJSON         bool
+		cacheEnabled, maintenance                bool
+		movieCacheSize                           int
+		searchThreshold                          float64
+		maxStreamSubscribers, importMaxRows      int
+		pageSizeDefault, pageSizeMax             int
+		dbMaxOpenConns, dbMaxIdleConns           int
+		dbRetries                                int
+		dbMaxIdleTime, dbTimeout, dbBatchTimeout time.Duration
+		readTimeout, writeTimeout, idleTimeout   time.Duration
+		slowQuery                                time.Duration
+		disabledFeatures                         featureList
+	)
+
+	flag.StringVar(&env, "env", "", "environment, development, staging or production, overrides ENV")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file, overrides TLS_CERT")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file, overrides TLS_KEY")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "space separated proxy CIDRs, overrides TRUSTED_PROXIES")
+	flag.StringVar(&baseURL, "base-url", "", "public URL of the API such as https://api.example.com, overrides BASE_URL")
+	flag.IntVar(&dbMaxOpenConns, "db-max-open-conns", 0, "maximum open database connections, overrides DB_MAX_OPEN_CONNS")
+	flag.IntVar(&dbMaxIdleConns, "db-max-idle-conns", 0, "maximum idle database connections, overrides DB_MAX_IDLE_CONNS")
+	flag.DurationVar(&dbMaxIdleTime, "db-max-idle-time", 0, "how long a database connection may stay idle, overrides DB_MAX_IDLE_TIME")
+	flag.DurationVar(&dbTimeout, "db-timeout", 0, "maximum duration of a database query, overrides DB_TIMEOUT")
+	flag.DurationVar(&dbBatchTimeout, "db-batch-timeout", 0, "maximum duration of a write to many movies at once, overrides DB_BATCH_TIMEOUT")
+	flag.DurationVar(&readTimeout, "read-timeout", 0, "maximum duration of reading a request, overrides READ_TIMEOUT")
+	flag.DurationVar(&writeTimeout, "write-timeout", 0, "maximum duration of writing a response, overrides WRITE_TIMEOUT")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 0, "how long a keep-alive connection may stay idle, overrides IDLE_TIMEOUT")
+	flag.IntVar(&dbRetries, "db-retries", -1, "retries of a movie query failing with a transient error, 0 disables them, overrides DB_RETRIES")
+	flag.DurationVar(&slowQuery, "slow-query-threshold", 0, "minimum duration of a movie query logged as slow, overrides SLOW_QUERY_THRESHOLD")
+	flag.IntVar(&pageSizeDefault, "page-size-default", 0, "page size of the listings without page_size, overrides PAGE_SIZE_DEFAULT")
+	flag.IntVar(&pageSizeMax, "page-size-max", 0, "maximum page_size of the listings, overrides PAGE_SIZE_MAX")
+	flag.StringVar(&logFormat, "log-format", "json", "format of the log lines, json or text")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level of the log lines, debug, info, warn or error")
+	flag.Float64Var(&limiterRps, "limiter-rps", 0, "requests a second allowed to each client, overrides LIMITER_RPS")
+	flag.IntVar(&limiterBurst, "limiter-burst", 0, "requests a client may make at once, overrides LIMITER_BURST")
+	flag.BoolVar(&limiterEnabled, "limiter-enabled", false, "rate limit the clients, -limiter-enabled=false turns it off, overrides LIMITER_ENABLED")
+	flag.StringVar(&limiterStore, "limiter-store", "", "where the rate limiter counts requests, memory or redis, overrides LIMITER_STORE")
+	flag.StringVar(&redisAddr, "redis-addr", "", "Redis address such as localhost:6379, overrides REDIS_ADDR")
+	flag.BoolVar(&metricsEnabled, "metrics-enabled", false, "serve /debug/metrics, -metrics-enabled=false turns it off, overrides METRICS_ENABLED")
+	flag.StringVar(&corsTrustedOrigins, "cors-trusted-origins", "", "space separated origins allowed by CORS, * for any, overrides CORS_TRUSTED_ORIGINS")
+	flag.DurationVar(&corsMaxAge, "cors-max-age", 0, "how long browsers may cache a CORS preflight, overrides CORS_MAX_AGE")
+	flag.BoolVar(&corsAllowCredentials, "cors-allow-credentials", false, "allow credentialed CORS requests, overrides CORS_ALLOW_CREDENTIALS")
+	flag.BoolVar(&prettyJSON, "pretty-json", false, "indent every JSON response, overrides PRETTY_JSON")
+	flag.BoolVar(&strictGenres, "strict-genres", false, "only accept known genres, -strict-genres=false allows any for migrations, overrides STRICT_GENRES")
+	flag.Float64Var(&searchThreshold, "search-threshold", 0, "minimum title similarity of the q search, overrides SEARCH_THRESHOLD")
+	flag.IntVar(&maxStreamSubscribers, "max-stream-subscribers", 0, "maximum concurrent movie event streams, overrides STREAM_MAX_SUBSCRIBERS")
+	flag.IntVar(&importMaxRows, "import-max-rows", 0, "maximum rows of an imported CSV file, overrides IMPORT_MAX_ROWS")
+	flag.Int64Var(&importMaxBytes, "import-max-bytes", 0, "maximum size of an import request, overrides IMPORT_MAX_BYTES")
+	flag.StringVar(&smtpHost, "smtp-host", "", "SMTP server host, overrides SMTP_HOST")
+	flag.IntVar(&smtpPort, "smtp-port", 0, "SMTP server port, overrides SMTP_PORT")
+	flag.StringVar(&smtpUsername, "smtp-username", "", "SMTP username, overrides SMTP_USERNAME")
+	flag.StringVar(&smtpPassword, "smtp-password", "", "SMTP password, overrides SMTP_PASSWORD")
+	flag.StringVar(&smtpSender, "smtp-sender", "", "sender of the emails such as MovieDB <no-reply@example.com>, overrides SMTP_SENDER")
+	flag.StringVar(&uploadsDir, "uploads-dir", "", "directory of the uploaded posters, overrides UPLOADS_DIR")
+	flag.Int64Var(&posterMaxBytes, "poster-max-bytes", 0, "maximum size of an uploaded poster, overrides POSTER_MAX_BYTES")
+	flag.BoolVar(&cacheEnabled, "cache-enabled", false, "cache the movies fetched by id, overrides CACHE_ENABLED")
+	flag.IntVar(&movieCacheSize, "movie-cache-size", 0, "maximum movies kept in the cache, overrides MOVIE_CACHE_SIZE")
+	flag.BoolVar(&maintenance, "maintenance", false, "start in maintenance mode, overrides MAINTENANCE until the next SIGHUP")
+	flag.Var(&disabledFeatures, "disable-feature", "switch off a feature, can be repeated, adds to DISABLED_FEATURES")
+	flag.Parse()
+
+	level := new(slog.LevelVar)
+
+	err := level.UnmarshalText([]byte(logLevel))
+	if err != nil {
+		fatal(slog.New(slog.NewJSONHandler(os.Stdout, nil)), fmt.Errorf("log level must be debug, info, warn or error, got %q", logLevel))
+	}
+
+	logger, err := newLogger(os.Stdout, logFormat, level)
+	if err != nil {
+		fatal(slog.New(slog.NewJSONHandler(os.Stdout, nil)), err)
+	}
 
 	config, err := LoadConfig(".env")
 	if err != nil {
-		logger.PrintFatal(err, nil)
+		fatal(logger, err)
+	}
+
+	if env != "" {
+		config.Env = env
+	}
+
+	// Only development exposes the internal errors to clients
+	if !validator.In(config.Env, "development", "staging", "production") {
+		fatal(logger, fmt.Errorf("ENV must be development, staging or production, got %q", config.Env))
+	}
+
+	if tlsCert != "" {
+		config.TlsCert = tlsCert
+	}
+	if tlsKey != "" {
+		config.TlsKey = tlsKey
+	}
+
+	if (config.TlsCert == "") != (config.TlsKey == "") {
+		fatal(logger, errors.New("TLS needs both a certificate and a key"))
+	}
+
+	if trustedProxies != "" {
+		config.TrustedProxies = trustedProxies
+	}
+
+	proxies, err := parseCIDRs(config.TrustedProxies)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			fatal(logger, fmt.Errorf("BASE_URL must be an absolute http or https URL without a query, got %q", config.BaseURL))
+		}
+	}
+
+	if flagPassed("metrics-enabled") {
+		config.MetricsEnabled = metricsEnabled
+	}
+
+	if corsTrustedOrigins != "" {
+		config.CorsTrustedOrigins = strings.Join(strings.Fields(corsTrustedOrigins), " ")
+	}
+	if corsMaxAge != 0 {
+		config.CorsMaxAge = corsMaxAge.String()
+	}
+	if corsAllowCredentials {
+		config.CorsAllowCredentials = true
+	}
+	if prettyJSON {
+		config.PrettyJSON = true
+	}
+
+	if maxAge, err := time.ParseDuration(config.CorsMaxAge); err != nil || maxAge < 0 {
+		fatal(logger, fmt.Errorf("CORS_MAX_AGE must be a positive duration, got %q", config.CorsMaxAge))
+	}
+
+	// Browsers refuse credentialed responses allowing every origin
+	if config.CorsAllowCredentials && validator.In("*", strings.Fields(config.CorsTrustedOrigins)...) {
+		fatal(logger, errors.New(`CORS_ALLOW_CREDENTIALS cannot be used with the "*" trusted origin`))
+	}
+
+	features, err := newFeatureFlags(append(strings.Fields(config.DisabledFeatures), disabledFeatures...), config.FeatureDisabledStatus)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	if limiterRps != 0 {
+		config.LimiterRps = limiterRps
+	}
+	if limiterBurst != 0 {
+		config.LimiterBurst = limiterBurst
+	}
+	if flagPassed("limiter-enabled") {
+		config.LimiterEnabled = limiterEnabled
+	}
+
+	if config.LimiterEnabled && (config.LimiterRps <= 0 || config.LimiterBurst < 1) {
+		fatal(logger, fmt.Errorf("LIMITER_RPS must be positive and LIMITER_BURST at least 1, got %g and %d", config.LimiterRps, config.LimiterBurst))
+	}
+
+	if limiterStore != "" {
+		config.LimiterStore = limiterStore
+	}
+	if redisAddr != "" {
+		config.RedisAddr = redisAddr
+	}
+
+	// The Redis store shares the allowance of a client between replicas
+	var limiter Limiter
+
+	switch config.LimiterStore {
+	case "memory":
+		limiter = newMemoryLimiter(config.LimiterRps, config.LimiterBurst)
+	case "redis":
+		if config.RedisAddr == "" {
+			fatal(logger, errors.New("LIMITER_STORE redis needs REDIS_ADDR"))
+		}
+
+		limiter = newRedisLimiter(config.RedisAddr, config.LimiterRps, config.LimiterBurst)
+	default:
+		fatal(logger, fmt.Errorf("LIMITER_STORE must be memory or redis, got %q", config.LimiterStore))
+	}
+
+	if dbMaxOpenConns != 0 {
+		config.DbMaxOpenConns = dbMaxOpenConns
+	}
+	if dbMaxIdleConns != 0 {
+		config.DbMaxIdleConns = dbMaxIdleConns
+	}
+	if dbMaxIdleTime != 0 {
+		config.DbMaxIdleTime = dbMaxIdleTime.String()
 	}
 
 	// db connect
 	db, err := openDB(config)
 	if err != nil {
-		logger.PrintFatal(err, nil)
+		fatal(logger, err)
 	}
 
 	defer db.Close()
 
-	logger.PrintInfo("database connection pool established", nil)
+	logger.Info("database connection pool established",
+		"max_open_conns", config.DbMaxOpenConns,
+		"max_idle_conns", config.DbMaxIdleConns,
+		"max_idle_time", config.DbMaxIdleTime,
+	)
+
+	if dbTimeout != 0 {
+		config.DbTimeout = dbTimeout.String()
+	}
+	if dbBatchTimeout != 0 {
+		config.DbBatchTimeout = dbBatchTimeout.String()
+	}
+
+	if dbRetries >= 0 {
+		config.DbRetries = dbRetries
+	}
+
+	if config.DbRetries < 0 {
+		fatal(logger, fmt.Errorf("DB_RETRIES must not be negative, got %d", config.DbRetries))
+	}
+
+	queryTimeout, err := time.ParseDuration(config.DbTimeout)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	batchTimeout, err := time.ParseDuration(config.DbBatchTimeout)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	if flagPassed("strict-genres") {
+		config.StrictGenres = strictGenres
+	}
+
+	if searchThreshold != 0 {
+		config.SearchThreshold = searchThreshold
+	}
+
+	if config.SearchThreshold <= 0 || config.SearchThreshold >= 1 {
+		fatal(logger, fmt.Errorf("SEARCH_THRESHOLD must be between 0 and 1, got %g", config.SearchThreshold))
+	}
+
+	if pageSizeDefault != 0 {
+		config.PageSizeDefault = pageSizeDefault
+	}
+	if pageSizeMax != 0 {
+		config.PageSizeMax = pageSizeMax
+	}
+
+	if config.PageSizeDefault < 1 || config.PageSizeDefault > config.PageSizeMax {
+		fatal(logger, fmt.Errorf("PAGE_SIZE_DEFAULT must be between 1 and PAGE_SIZE_MAX (%d)", config.PageSizeMax))
+	}
+
+	if slowQuery != 0 {
+		config.SlowQueryThreshold = slowQuery.String()
+	}
+
+	slowQueryThreshold, err := time.ParseDuration(config.SlowQueryThreshold)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	dashboardCacheTTL, err := time.ParseDuration(config.DashboardCacheTTL)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	if maxStreamSubscribers != 0 {
+		config.StreamMaxSubscribers = maxStreamSubscribers
+	}
+
+	if config.StreamMaxSubscribers < 1 {
+		fatal(logger, fmt.Errorf("STREAM_MAX_SUBSCRIBERS must be at least 1, got %d", config.StreamMaxSubscribers))
+	}
+
+	if importMaxRows != 0 {
+		config.ImportMaxRows = importMaxRows
+	}
+
+	if config.ImportMaxRows < 1 {
+		fatal(logger, fmt.Errorf("IMPORT_MAX_ROWS must be at least 1, got %d", config.ImportMaxRows))
+	}
+
+	if importMaxBytes != 0 {
+		config.ImportMaxBytes = importMaxBytes
+	}
+
+	if config.ImportMaxBytes < 1 {
+		fatal(logger, fmt.Errorf("IMPORT_MAX_BYTES must be at least 1, got %d", config.ImportMaxBytes))
+	}
+
+	if uploadsDir != "" {
+		config.UploadsDir = uploadsDir
+	}
+	if posterMaxBytes != 0 {
+		config.PosterMaxBytes = posterMaxBytes
+	}
+
+	// An empty directory would store the posters next to the binary and .env
+	if strings.TrimSpace(config.UploadsDir) == "" {
+		fatal(logger, errors.New("UPLOADS_DIR must not be empty"))
+	}
+
+	if config.PosterMaxBytes < 1 {
+		fatal(logger, fmt.Errorf("POSTER_MAX_BYTES must be at least 1, got %d", config.PosterMaxBytes))
+	}
+
+	if cacheEnabled {
+		config.CacheEnabled = true
+	}
+	if movieCacheSize != 0 {
+		config.MovieCacheSize = movieCacheSize
+	}
+
+	if config.CacheEnabled && config.MovieCacheSize < 1 {
+		fatal(logger, fmt.Errorf("MOVIE_CACHE_SIZE must be at least 1, got %d", config.MovieCacheSize))
+	}
+
+	if readTimeout != 0 {
+		config.ReadTimeout = readTimeout.String()
+	}
+	if writeTimeout != 0 {
+		config.WriteTimeout = writeTimeout.String()
+	}
+	if idleTimeout != 0 {
+		config.IdleTimeout = idleTimeout.String()
+	}
+
+	if maintenance {
+		config.Maintenance = true
+	}
+
+	if smtpHost != "" {
+		config.SmtpHost = smtpHost
+	}
+	if smtpPort != 0 {
+		config.SmtpPort = smtpPort
+	}
+	if smtpUsername != "" {
+		config.SmtpUsername = smtpUsername
+	}
+	if smtpPassword != "" {
+		config.SmtpPassword = smtpPassword
+	}
+	if smtpSender != "" {
+		config.SmtpSender = smtpSender
+	}
+
+	if config.SmtpPort < 1 || config.SmtpPort > 65535 {
+		fatal(logger, fmt.Errorf("SMTP_PORT must be between 1 and 65535, got %d", config.SmtpPort))
+	}
 
 	app := &application{
-		config: config,
-		logger: logger,
-		model:  data.NewModel(db),
+		config:   config,
+		logger:   logger,
+		logLevel: level,
+		db:       db,
+		model:    data.NewModel(db, queryTimeout, batchTimeout, config.DbRetries, logger, slowQueryThreshold),
+		mailer:   mailer.New(config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword, config.SmtpSender),
+
+		trustedProxies: proxies,
+		features:       features,
+		limiter:        limiter,
+	}
+
+	if config.CacheEnabled {
+		cache := data.NewCachedMovieModel(app.model.Movie.(data.MovieModel), config.MovieCacheSize)
+		app.model.Movie = cache
+
+		if config.MetricsEnabled {
+			promauto.NewCounterFunc(prometheus.CounterOpts{
+				Name: "movie_cache_hits",
+				Help: "Total number of movie reads served from the cache.",
+			}, func() float64 { return float64(cache.Hits()) })
+			promauto.NewCounterFunc(prometheus.CounterOpts{
+				Name: "movie_cache_misses",
+				Help: "Total number of movie reads that missed the cache.",
+			}, func() float64 { return float64(cache.Misses()) })
+		}
+	}
+
+	app.dashboard.ttl = dashboardCacheTTL
+
+	app.movieEvents.max = config.StreamMaxSubscribers
+
+	app.maintenance.Store(config.Maintenance)
+	go app.reloadMaintenanceOnSIGHUP()
+
+	server, err := app.newServer()
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	logger.Info("Starting server",
+		"addr", server.Addr,
+		"version", buildVersion(),
+		"env", config.Env,
+		"tls", server.TLSConfig != nil,
+		"read_timeout", server.ReadTimeout.String(),
+		"read_header_timeout", server.ReadHeaderTimeout.String(),
+		"write_timeout", server.WriteTimeout.String(),
+		"idle_timeout", server.IdleTimeout.String(),
+		"max_header_bytes", server.MaxHeaderBytes,
+		"disabled_features", strings.Join(features.Disabled(), " "),
+	)
+
+	err = app.serve(server)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	logger.Info("stopped server", "addr", server.Addr)
+}
+
+// serve runs the server until SIGINT or SIGTERM, then lets the in-flight requests
+// and background tasks finish before returning
+func (app *application) serve(server *http.Server) error {
+	shutdownError := make(chan error)
+
+	// The signals are caught before the server accepts requests, an early one still
+	// waits for the background tasks
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	go func() {
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		err := server.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.Info("completing background tasks", "addr", server.Addr)
+
+		app.wg.Wait()
+		shutdownError <- nil
+	}()
+
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS(app.config.TlsCert, app.config.TlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return <-shutdownError
+}
+
+// newServer builds the http.Server with the configured timeouts. Queries are bounded
+// by DB_TIMEOUT on their own, the write timeout only caps the whole response.
+func (app *application) newServer() (*http.Server, error) {
+	timeouts := map[string]string{
+		"READ_TIMEOUT":        app.config.ReadTimeout,
+		"READ_HEADER_TIMEOUT": app.config.ReadHeaderTimeout,
+		"WRITE_TIMEOUT":       app.config.WriteTimeout,
+		"IDLE_TIMEOUT":        app.config.IdleTimeout,
+	}
+
+	durations := make(map[string]time.Duration, len(timeouts))
+
+	for key, value := range timeouts {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+
+		durations[key] = duration
 	}
 
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", config.Port),
-		Handler:      app.routes(),
-		ErrorLog:     log.New(logger, "", 0),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:              fmt.Sprintf(":%d", app.config.Port),
+		Handler:           app.routes(),
+		ErrorLog:          slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		ReadTimeout:       durations["READ_TIMEOUT"],
+		ReadHeaderTimeout: durations["READ_HEADER_TIMEOUT"],
+		WriteTimeout:      durations["WRITE_TIMEOUT"],
+		IdleTimeout:       durations["IDLE_TIMEOUT"],
+		MaxHeaderBytes:    app.config.MaxHeaderBytes,
 	}
 
-	logger.PrintInfo("Starting server", map[string]string{
-		"addr": server.Addr,
-		"env":  config.Env,
+	server.RegisterOnShutdown(app.movieEvents.close)
+
+	// Without a certificate the server speaks plain HTTP/1.1, a proxy in front terminates TLS
+	if app.config.TlsCert != "" {
+		server.TLSConfig = &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+			// TLS 1.3 suites are not configurable, these only restrict TLS 1.2 to AEAD with forward secrecy
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			},
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+
+	return server, nil
+}
+
+// reloadMaintenanceOnSIGHUP re-reads the config file on every SIGHUP and applies its
+// MAINTENANCE setting, the other settings need a restart
+func (app *application) reloadMaintenanceOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		err := viper.ReadInConfig()
+		if err != nil {
+			app.logger.Error(err.Error())
+			continue
+		}
+
+		maintenance := viper.GetBool("MAINTENANCE")
+		app.maintenance.Store(maintenance)
+
+		app.logger.Info("maintenance mode reloaded", "maintenance", maintenance)
+	}
+}
+
+// newLogger writes the log lines to out through a JSON or text handler, lines below
+// level are dropped and level can be changed while the logger is in use
+func newLogger(out io.Writer, format string, level *slog.LevelVar) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	default:
+		return nil, fmt.Errorf("log format must be json or text, got %q", format)
+	}
+}
+
+// fatal logs err at error level and exits, for the errors that stop the server from starting
+func fatal(logger *slog.Logger, err error) {
+	logger.Error(err.Error())
+	os.Exit(1)
+}
+
+// flagPassed reports whether the flag was given on the command line, so a boolean flag
+// can override a config value of true with false
+func flagPassed(name string) bool {
+	passed := false
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
 	})
 
-	err = server.ListenAndServe()
-	logger.PrintFatal(err, nil)
+	return passed
+}
+
+// parseCIDRs parses a space separated list of CIDRs such as "10.0.0.0/8 192.168.1.1/32"
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, cidr := range strings.Fields(s) {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
 }
 
 func openDB(config Config) (*sql.DB, error) {
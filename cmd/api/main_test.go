@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeWaitsForBackgroundTasks(t *testing.T) {
+	app := newTestApplication(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server := &http.Server{Addr: addr, Handler: http.NotFoundHandler()}
+
+	var finished atomic.Bool
+
+	app.background(func() {
+		time.Sleep(200 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	served := make(chan error)
+	go func() { served <- app.serve(server) }()
+
+	// serve catches the signals before it listens
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+		assert.True(t, finished.Load(), "serve returned before the background task finished")
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after SIGTERM")
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.ReadTimeout = "7s"
+	app.config.ReadHeaderTimeout = "2s"
+	app.config.WriteTimeout = "45s"
+	app.config.IdleTimeout = "90s"
+
+	server, err := app.newServer()
+	require.NoError(t, err)
+
+	assert.Equal(t, 7*time.Second, server.ReadTimeout)
+	assert.Equal(t, 2*time.Second, server.ReadHeaderTimeout)
+	assert.Equal(t, 45*time.Second, server.WriteTimeout)
+	assert.Equal(t, 90*time.Second, server.IdleTimeout)
+
+	app.config.WriteTimeout = "forever"
+
+	_, err = app.newServer()
+	assert.EqualError(t, err, `invalid WRITE_TIMEOUT: time: invalid duration "forever"`)
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   slog.Level
+		want    string
+		wantErr string
+	}{
+		{name: "json", format: "json", level: slog.LevelInfo, want: `^\{"time":"\S+","level":"WARN","msg":"slow query","query":"GetAll","title":"star wars"\}\n$`},
+		{name: "text", format: "text", level: slog.LevelInfo, want: `^time=\S+ level=WARN msg="slow query" query=GetAll title="star wars"\n$`},
+		{name: "level above", format: "json", level: slog.LevelError, want: `^$`},
+		{name: "unknown format", format: "logfmt", level: slog.LevelInfo, wantErr: `log format must be json or text, got "logfmt"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			level := new(slog.LevelVar)
+			level.Set(tt.level)
+
+			logger, err := newLogger(&out, tt.format, level)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			logger.Warn("slow query", "query", "GetAll", "title", "star wars")
+			assert.Regexp(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestNewLoggerLevelChangedAtRuntime(t *testing.T) {
+	var out bytes.Buffer
+
+	level := new(slog.LevelVar)
+
+	logger, err := newLogger(&out, "json", level)
+	require.NoError(t, err)
+
+	logger.Debug("query executed", "query", "Get")
+	assert.Empty(t, out.String())
+
+	level.Set(slog.LevelDebug)
+
+	logger.Debug("query executed", "query", "Get")
+	assert.Contains(t, out.String(), `"level":"DEBUG","msg":"query executed"`)
+
+	out.Reset()
+	level.Set(slog.LevelError)
+
+	logger.Warn("rate limiter unavailable")
+	assert.Empty(t, out.String())
+}
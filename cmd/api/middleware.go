@@ -1,14 +1,33 @@
 package main
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// recoverPanic turns a panic in a handler into a 500 JSON response, the error
+// is logged with the stack trace of the panicking goroutine
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				// ErrAbortHandler deliberately aborts the response, let net/http handle it
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
 				w.Header().Set("Connection", "close")
 				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
 			}
@@ -17,3 +36,533 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestID tags every request with an id, reusing the X-Request-ID set by an upstream proxy
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		r = app.contextSetRequestID(r, requestID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit allows each client the requests of LIMITER_RPS and LIMITER_BURST, counted in
+// app.limiter. A limiter that cannot decide, such as an unreachable Redis, lets the
+// request through rather than failing the API with it.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	limiter := app.limiter
+	if limiter == nil {
+		limiter = newMemoryLimiter(app.config.LimiterRps, app.config.LimiterBurst)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.LimiterEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := limiter.Allow(r.Context(), app.realIP(r))
+		if err != nil {
+			app.logger.Warn("rate limiter unavailable, allowing the request",
+				"error", err,
+				"request_id", app.contextGetRequestID(r),
+			)
+			allowed = true
+		}
+
+		if !allowed {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceMode rejects writes to movie data with a 503 while maintenance is on,
+// reads and every other route (including the healthcheck) keep working
+func (app *application) maintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.maintenance.Load() && writesMovies(r.URL.Path) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				app.maintenanceResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writesMovies reports whether the writes to path change movie data, renaming a genre
+// rewrites the genres of every movie
+func writesMovies(path string) bool {
+	for _, prefix := range []string{"/v1/movies", "/v1/genres"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireFeature answers the status configured with FEATURE_DISABLED_STATUS instead of
+// calling next while the feature is disabled
+func (app *application) requireFeature(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.features.Enabled(name) {
+			if app.features.status == http.StatusServiceUnavailable {
+				app.featureDisabledResponse(w, r)
+				return
+			}
+
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.model.Token.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// realIP returns the IP of the client. Behind a trusted proxy it is read from X-Forwarded-For,
+// the rightmost address not belonging to a trusted proxy, or else from X-Real-IP. The headers
+// of any other peer are ignored so clients cannot spoof their IP to the rate limiter.
+func (app *application) realIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+
+	if !app.isTrustedProxy(peer) {
+		return peer
+	}
+
+	if header := r.Header.Get("X-Forwarded-For"); header != "" {
+		hops := strings.Split(header, ",")
+
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+
+			client = hop
+			if !app.isTrustedProxy(hop) {
+				break
+			}
+		}
+
+		if client != "" {
+			return client
+		}
+	}
+
+	if header := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(header) != nil {
+		return header
+	}
+
+	return peer
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range app.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enableCORS answers the trusted origins, "*" trusts every origin. With credentials allowed
+// the origin is echoed, browsers reject a credentialed response allowing "*".
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	trustedOrigins := strings.Fields(app.config.CorsTrustedOrigins)
+	anyOrigin := validator.In("*", trustedOrigins...)
+
+	// CORS_MAX_AGE is checked at startup
+	maxAge, _ := time.ParseDuration(app.config.CorsMaxAge)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		// Untrusted origins simply do not get the CORS headers
+		if origin != "" && (anyOrigin || validator.In(origin, trustedOrigins...)) {
+			if anyOrigin && !app.config.CorsAllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if app.config.CorsAllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Preflight request
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+
+				// Browsers cache the preflight for that long, without it they ask before every request
+				if maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				}
+
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.model.Permission.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// metricsResponseWriter records the status code written by the wrapped handler
+type metricsResponseWriter struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+func (mw *metricsResponseWriter) Header() http.Header {
+	return mw.wrapped.Header()
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	mw.wrapped.WriteHeader(statusCode)
+
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.wrapped.Write(b)
+}
+
+func (mw *metricsResponseWriter) Flush() {
+	mw.headerWritten = true
+
+	if flusher, ok := mw.wrapped.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// prettyJSON marks a request with ?pretty=true in its context, writeJSON then indents
+// the response for debugging with curl. It runs before the middleware that can answer
+// on their own, so their errors are indented too.
+func (app *application) prettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+			r = app.contextSetPretty(r, true)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) metrics(next http.Handler) http.Handler {
+	if !app.config.MetricsEnabled {
+		return next
+	}
+
+	var (
+		totalRequestsReceived = promauto.NewCounter(prometheus.CounterOpts{
+			Name: "total_requests_received",
+			Help: "Total number of requests received.",
+		})
+		totalResponsesSent = promauto.NewCounter(prometheus.CounterOpts{
+			Name: "total_responses_sent",
+			Help: "Total number of responses sent.",
+		})
+		processingTime = promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "processing_time_microseconds",
+			Help:    "Time taken to process a request in microseconds.",
+			Buckets: prometheus.ExponentialBuckets(100, 4, 10),
+		})
+		totalResponsesSentByStatus = promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "total_responses_sent_by_status",
+			Help: "Total number of responses sent by HTTP status code.",
+		}, []string{"status"})
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		totalRequestsReceived.Inc()
+
+		mw := newMetricsResponseWriter(w)
+
+		next.ServeHTTP(mw, r)
+
+		totalResponsesSent.Inc()
+		totalResponsesSentByStatus.WithLabelValues(strconv.Itoa(mw.statusCode)).Inc()
+		processingTime.Observe(float64(time.Since(start).Microseconds()))
+	})
+}
+
+// gzipResponseWriter buffers the body until it reaches minBytes, then either
+// starts compressing or, for already compressed content, passes it through
+type gzipResponseWriter struct {
+	wrapped    http.ResponseWriter
+	minBytes   int
+	statusCode int
+	buf        []byte
+	gz         *gzip.Writer
+	started    bool
+}
+
+func (gw *gzipResponseWriter) Header() http.Header {
+	return gw.wrapped.Header()
+}
+
+func (gw *gzipResponseWriter) WriteHeader(statusCode int) {
+	if gw.statusCode == 0 {
+		gw.statusCode = statusCode
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.started {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.wrapped.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+
+	if len(gw.buf) >= gw.minBytes {
+		err := gw.start(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// start writes the status code and buffered body, compressing them when allowed
+func (gw *gzipResponseWriter) start(compress bool) error {
+	gw.started = true
+
+	if gw.statusCode == 0 {
+		gw.statusCode = http.StatusOK
+	}
+
+	if compress && isCompressible(gw.Header()) {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.wrapped)
+	}
+
+	gw.wrapped.WriteHeader(gw.statusCode)
+
+	if len(gw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(gw.buf)
+	} else {
+		_, err = gw.wrapped.Write(gw.buf)
+	}
+
+	gw.buf = nil
+	return err
+}
+
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.started {
+		gw.start(true)
+	}
+
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+
+	if flusher, ok := gw.wrapped.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close sends a small body uncompressed or finishes the gzip stream
+func (gw *gzipResponseWriter) Close() error {
+	if !gw.started {
+		return gw.start(false)
+	}
+
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+
+	return nil
+}
+
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.wrapped
+}
+
+func isCompressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/gzip", "application/zip"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{
+			wrapped:  w,
+			minBytes: app.config.CompressMinBytes,
+		}
+
+		defer func() {
+			err := gw.Close()
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "close", rr.Header().Get("Connection"))
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	decodeJSON(t, rr, &response)
+
+	assert.Equal(t, "the server encountered a problem and could not process your request", response.Error)
+}
+
+func TestRecoverPanicRepanicsOnAbortHandler(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	app := newTestApplication(t)
+	app.maintenance.Store(true)
+
+	handler := app.maintenanceMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{method: http.MethodGet, target: "/v1/movies", wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/v1/movies/1", wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/v1/healthcheck", wantStatus: http.StatusOK},
+		{method: http.MethodPost, target: "/v1/users", wantStatus: http.StatusOK},
+		{method: http.MethodPost, target: "/v1/movies", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPut, target: "/v1/movies/1", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPatch, target: "/v1/movies/1", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodDelete, target: "/v1/movies/1", wantStatus: http.StatusServiceUnavailable},
+		{method: http.MethodPost, target: "/v1/genres/rename", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, nil))
+
+			require.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.wantStatus == http.StatusServiceUnavailable {
+				assert.Equal(t, "300", rr.Header().Get("Retry-After"))
+				assert.JSONEq(t, `{"error":"service under maintenance"}`, rr.Body.String())
+			}
+		})
+	}
+
+	app.maintenance.Store(false)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/movies", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRealIP(t *testing.T) {
+	app := newTestApplication(t)
+
+	proxies, err := parseCIDRs("10.0.0.0/8 192.168.1.1/32")
+	require.NoError(t, err)
+	app.trustedProxies = proxies
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor string
+		xRealIP       string
+		want          string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4242", want: "203.0.113.7"},
+		{name: "spoofed forwarded for", remoteAddr: "203.0.113.7:4242", xForwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "spoofed real ip", remoteAddr: "203.0.113.7:4242", xRealIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.5:4242", xForwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.5:4242", xForwardedFor: "198.51.100.1, 192.168.1.1, 10.0.0.9", want: "198.51.100.1"},
+		{name: "spoofed hop before the client", remoteAddr: "10.0.0.5:4242", xForwardedFor: "1.2.3.4, 198.51.100.1", want: "198.51.100.1"},
+		{name: "trusted proxy with real ip", remoteAddr: "10.0.0.5:4242", xRealIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "trusted proxy with garbage", remoteAddr: "10.0.0.5:4242", xForwardedFor: "not-an-ip", want: "10.0.0.5"},
+		{name: "trusted proxy without headers", remoteAddr: "10.0.0.5:4242", want: "10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.xForwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.xForwardedFor)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			assert.Equal(t, tt.want, app.realIP(r))
+		})
+	}
+}
+
+func TestEnableCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name             string
+		trustedOrigins   string
+		maxAge           string
+		allowCredentials bool
+		origin           string
+		wantOrigin       string
+		wantCredentials  string
+		wantMaxAge       string
+	}{
+		{name: "any origin", trustedOrigins: "*", maxAge: "10m", origin: "https://app.example.org", wantOrigin: "*", wantMaxAge: "600"},
+		{name: "trusted origin", trustedOrigins: "https://app.example.org", maxAge: "0s", origin: "https://app.example.org", wantOrigin: "https://app.example.org"},
+		{name: "credentials echo the origin", trustedOrigins: "https://app.example.org https://admin.example.org", maxAge: "1h", allowCredentials: true, origin: "https://admin.example.org", wantOrigin: "https://admin.example.org", wantCredentials: "true", wantMaxAge: "3600"},
+		{name: "untrusted origin", trustedOrigins: "https://app.example.org", maxAge: "1h", allowCredentials: true, origin: "https://evil.example.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.CorsTrustedOrigins = tt.trustedOrigins
+			app.config.CorsMaxAge = tt.maxAge
+			app.config.CorsAllowCredentials = tt.allowCredentials
+
+			handler := app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			r := httptest.NewRequest(http.MethodOptions, "/v1/movies/1", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantCredentials, rr.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, tt.wantMaxAge, rr.Header().Get("Access-Control-Max-Age"))
+			assert.Equal(t, []string{"Origin", "Access-Control-Request-Method"}, rr.Header().Values("Vary"))
+
+			// An untrusted preflight falls through to the router unanswered
+			if tt.wantOrigin == "" {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+				return
+			}
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "OPTIONS, PUT, PATCH, DELETE", rr.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "Authorization, Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+		})
+	}
+}
+
+func TestEnableCORSCredentialedRequest(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.CorsTrustedOrigins = "https://app.example.org"
+	app.config.CorsAllowCredentials = true
+
+	handler := app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Origin", "https://app.example.org")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://app.example.org", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Empty(t, rr.Header().Get("Access-Control-Max-Age"))
+}
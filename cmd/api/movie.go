@@ -1,144 +1,1062 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/harryng22/moviedb/internal/data"
 	"github.com/harryng22/moviedb/internal/validator"
+	"github.com/julienschmidt/httprouter"
 )
 
 type Input struct {
-	Title   *string       `json:"title"`
-	Year    *int32        `json:"year"`
-	Runtime *data.Runtime `json:"runtime"`
-	Genres  []string      `json:"genres"`
+	Title   *string        `json:"title"`
+	Year    *int32         `json:"year"`
+	Runtime *data.Runtime  `json:"runtime"`
+	Genres  OptionalGenres `json:"genres"`
 }
 
+// OptionalGenres tells a missing genres key apart from an explicit null, a patch
+// leaves the genres alone in the first case and clears them in the second
+type OptionalGenres struct {
+	Set   bool
+	Value []string
+}
+
+func (g *OptionalGenres) UnmarshalJSON(jsonValue []byte) error {
+	g.Set = true
+
+	if string(jsonValue) == "null" {
+		g.Value = nil
+		return nil
+	}
+
+	return json.Unmarshal(jsonValue, &g.Value)
+}
+
+func (g OptionalGenres) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Value)
+}
+
+// createMovieHandler creates a movie, optionally with an external_id. With If-None-Match: *
+// and an external_id the request only creates the movie when no movie has that external id
+// yet, otherwise it fails with 409 and the Location of the existing movie.
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Input
+		ExternalID string `json:"external_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validation
+	v := validator.New()
+
+	// Required fields must be present before they are dereferenced
+	conditional := r.Header.Get("If-None-Match") != ""
+
+	if conditional {
+		v.Check(r.Header.Get("If-None-Match") == "*", "if_none_match", "must be *")
+		v.Check(input.ExternalID != "", "external_id", "must be provided with If-None-Match")
+	}
+
+	if input.ExternalID != "" {
+		data.ValidateExternalID(v, input.ExternalID)
+	}
+
+	if validateInputPresence(v, input.Input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie := &data.Movie{
+		ExternalID: input.ExternalID,
+		Title:      *input.Title,
+		Year:       *input.Year,
+		Runtime:    *input.Runtime,
+		Genres:     input.Genres.Value,
+	}
+
+	// Movies created anonymously keep no creator
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		movie.CreatedBy = user.ID
+	}
+
+	data.ValidateMovie(v, movie)
+
+	err = app.validateKnownGenres(v, movie.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if conditional {
+		existing, err := app.model.Movie.GetByExternalID(input.ExternalID)
+		switch {
+		case err == nil:
+			app.movieExistsResponse(w, r, existing.ID)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Insert to db, at most once per Idempotency-Key of the user
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		replayed, err := app.model.Idempotency.InsertMovie(app.contextGetUser(r).ID, key, hashInput(input), 24*time.Hour, movie)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyReused):
+				v.AddError("idempotency_key", "must not be reused with a different request body")
+				app.failedValidationResponse(w, r, v)
+			case errors.Is(err, data.ErrDuplicateMovie):
+				v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+				app.failedValidationResponse(w, r, v)
+			case errors.Is(err, data.ErrDuplicateExternalID):
+				app.duplicateExternalIDResponse(w, r, input.ExternalID, conditional)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// A replay responds with the movie as the original request returned it
+		if !replayed {
+			app.movieEvents.publish(movie)
+		}
+	} else {
+		err = app.model.Movie.Insert(movie)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateMovie):
+				v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+				app.failedValidationResponse(w, r, v)
+			case errors.Is(err, data.ErrDuplicateExternalID):
+				app.duplicateExternalIDResponse(w, r, input.ExternalID, conditional)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.movieEvents.publish(movie)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", app.resourceURL(fmt.Sprintf("/v1/movies/%d", movie.ID)))
+
+	if app.writeMinimal(w, r, http.StatusCreated, headers) {
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// duplicateExternalIDResponse answers an insert that lost the race for the external id,
+// as a conflict for a conditional create and as a failed validation otherwise
+func (app *application) duplicateExternalIDResponse(w http.ResponseWriter, r *http.Request, externalID string, conditional bool) {
+	if conditional {
+		existing, err := app.model.Movie.GetByExternalID(externalID)
+		if err == nil {
+			app.movieExistsResponse(w, r, existing.ID)
+			return
+		}
+	}
+
+	v := validator.New()
+	v.AddErrorCode("external_id", validator.CodeDuplicate, "a movie with this external id already exists")
+	app.failedValidationResponse(w, r, v)
+}
+
+// upsertMovieHandler creates or replaces the movie with the external id of the URL, so
+// syncing from an external catalogue can be retried without reading first
+func (app *application) upsertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	externalID := httprouter.ParamsFromContext(r.Context()).ByName("child")
+
 	var input Input
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateExternalID(v, externalID)
+
+	if validateInputPresence(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie := &data.Movie{
+		ExternalID: externalID,
+		Title:      *input.Title,
+		Year:       *input.Year,
+		Runtime:    *input.Runtime,
+		Genres:     input.Genres.Value,
+	}
+
+	data.ValidateMovie(v, movie)
+
+	err = app.validateKnownGenres(v, movie.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	created, err := app.model.Movie.Upsert(movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateMovie):
+			v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", app.resourceURL(fmt.Sprintf("/v1/movies/%d", movie.ID)))
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMoviesBulkHandler(w http.ResponseWriter, r *http.Request) {
+	var inputs []Input
+
+	err := app.readJSON(w, r, &inputs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(inputs) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one movie"))
+		return
+	}
+
+	// Validate every movie, collecting the errors by array index
+	movies := make([]*data.Movie, len(inputs))
+	errs := make(map[string]*validator.Validator)
+
+	for i, input := range inputs {
+		movie := &data.Movie{}
+		copyProperties(input, movie)
+
+		v := validator.New()
+
+		data.ValidateMovie(v, movie)
+
+		err = app.validateKnownGenres(v, movie.Genres)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			errs[strconv.Itoa(i)] = v
+		}
+
+		movies[i] = movie
+	}
+
+	if len(errs) > 0 {
+		app.failedBatchValidationResponse(w, r, errs)
+		return
+	}
+
+	// Insert all movies in one transaction
+	err = app.model.Movie.InsertBatch(movies)
+	if err != nil {
+		var batchErr *data.BatchError
+
+		switch {
+		case errors.As(err, &batchErr) && errors.Is(err, data.ErrDuplicateMovie):
+			v := validator.New()
+			v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+			errs[strconv.Itoa(batchErr.Index)] = v
+			app.failedBatchValidationResponse(w, r, errs)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	runtimeFormat := app.readRuntimeFormat(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Fetch existing movie by Id
+	movie, err := app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie.RuntimeFormat = runtimeFormat
+
+	averageRating, ratingCount, err := app.model.Rating.AverageForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only the first page of the cast is embedded, the rest is at /v1/movies/:id/cast
+	cast, castMetadata, err := app.model.Actor.ActorsForMovie(movie.ID, data.Filter{Page: 1, PageSize: app.config.PageSizeDefault})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	favoriteCount, err := app.model.Favorite.CountForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"movie":          movie,
+		"average_rating": averageRating,
+		"rating_count":   ratingCount,
+		"favorite_count": favoriteCount,
+		"cast":           cast,
+		"cast_metadata":  castMetadata,
+	}
+
+	if movie.PosterPath != "" {
+		env["poster_url"] = app.resourceURL(fmt.Sprintf("/v1/movies/%d/poster", movie.ID))
+	}
+
+	// Anonymous requests have no watchlist or favorites, so the fields are left out entirely
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		watched, err := app.model.Watchlist.IsWatched(user.ID, movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["watched"] = watched
+
+		favorite, err := app.model.Favorite.IsFavorite(user.ID, movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["is_favorite"] = favorite
+	}
+
+	// The ETag covers the whole detail, as the counts and the fields of the user change
+	// without a new movie version. authenticate already varies the response on Authorization.
+	etag, err := movieDetailETag(movie, env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if wantsJSONAPI(r) {
+		app.writeMovieJSONAPI(w, r, env, cast, headers)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeMovieJSONAPI writes the movie detail as a JSON:API document, the cast becomes a
+// relationship and the remaining envelope fields its meta
+func (app *application) writeMovieJSONAPI(w http.ResponseWriter, r *http.Request, env envelope, cast []*data.CastMember, headers http.Header) {
+	resource, err := movieResource(env["movie"].(*data.Movie), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	relationship, included, err := castRelationship(cast)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	resource.Relationships = map[string]jsonAPIRelationship{"cast": relationship}
+
+	meta := make(map[string]interface{})
+	for key, value := range env {
+		if key != "movie" && key != "cast" {
+			meta[key] = value
+		}
+	}
+
+	err = app.writeJSONAPI(w, http.StatusOK, jsonAPIDocument{Data: resource, Included: included, Meta: meta}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMovieBySlugHandler serves GET /v1/movies/by-slug/:slug, the slug is routed as the :child param
+func (app *application) showMovieBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("child")
+
+	movie, err := app.model.Movie.GetBySlug(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) randomMovieHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	genres := app.readGenres(r.URL.Query(), v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie, err := app.model.Movie.GetRandom(genres)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxCompare caps how many movies a single comparison may include
+const maxCompare = 5
+
+// movieComparison holds the differences between compared movies, the differences are
+// between the largest and the smallest value
+type movieComparison struct {
+	SharedGenres      []string     `json:"shared_genres"`
+	RuntimeDifference data.Runtime `json:"runtime_difference"`
+	YearDifference    int32        `json:"year_difference"`
+}
+
+func compareMovies(movies []*data.Movie) movieComparison {
+	comparison := movieComparison{SharedGenres: []string{}}
+
+	minRuntime, maxRuntime := movies[0].Runtime, movies[0].Runtime
+	minYear, maxYear := movies[0].Year, movies[0].Year
+
+	for _, movie := range movies[1:] {
+		if movie.Runtime < minRuntime {
+			minRuntime = movie.Runtime
+		}
+		if movie.Runtime > maxRuntime {
+			maxRuntime = movie.Runtime
+		}
+		if movie.Year < minYear {
+			minYear = movie.Year
+		}
+		if movie.Year > maxYear {
+			maxYear = movie.Year
+		}
+	}
+
+	// Shared genres keep the order of the first movie
+	for _, genre := range movies[0].Genres {
+		shared := true
+
+		for _, movie := range movies[1:] {
+			if !validator.In(genre, movie.Genres...) {
+				shared = false
+				break
+			}
+		}
+
+		if shared {
+			comparison.SharedGenres = append(comparison.SharedGenres, genre)
+		}
+	}
+
+	comparison.RuntimeDifference = maxRuntime - minRuntime
+	comparison.YearDifference = maxYear - minYear
+
+	return comparison
+}
+
+// compareMoviesHandler returns 2 to 5 movies given as ?ids=1,2 side by side with their differences
+func (app *application) compareMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	values := app.readCSV(r.URL.Query(), "ids", []string{})
+	ids := make([]int64, 0, len(values))
+	seen := make(map[int64]bool, len(values))
+
+	for _, value := range values {
+		id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || id < 1 {
+			v.AddErrorCode("ids", validator.CodeInvalidFormat, "must only contain positive integers")
+			break
+		}
+
+		if seen[id] {
+			v.AddError("ids", "must not contain duplicate ids")
+			break
+		}
+		seen[id] = true
+
+		ids = append(ids, id)
+	}
+
+	if v.Valid() {
+		v.Check(len(ids) >= 2 && len(ids) <= maxCompare, "ids", fmt.Sprintf("must contain between 2 and %d ids", maxCompare))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movies, err := app.model.Movie.GetMany(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(movies) < len(ids) {
+		found := make(map[int64]bool, len(movies))
+		for _, movie := range movies {
+			found[movie.ID] = true
+		}
+
+		missing := []int64{}
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+
+		app.moviesNotFoundResponse(w, r, missing)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movies": movies, "comparison": compareMovies(movies)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportMovieHandler downloads a single movie as an indented JSON file, for archiving
+// a record from the browser
+func (app *application) exportMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	js, err := marshalJSON(envelope{"movie": movie}, true)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movie-%d.json"`, movie.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
+
+func (app *application) similarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	queryString := r.URL.Query()
+	filter := app.readPagination(queryString, v)
+
+	// limit is kept from before the endpoint was paginated, it sets the size of the first page
+	if queryString.Has("limit") {
+		limit := app.readInt(queryString, "limit", 5, v)
+
+		v.Check(limit >= 1 && limit <= 20, "limit", "must be between 1 and 20")
+		v.Check(!queryString.Has("page_size"), "limit", "must not be combined with page_size")
+
+		filter.PageSize = limit
+	}
+
+	if data.ValidateFilter(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	_, err = app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movies, metadata, err := app.model.Movie.Similar(id, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata.SetLinks(app.requestURL(r))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) movieHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	versions, err := app.model.Movie.History(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"history": versions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchInput is the body of a PATCH, which can also add and remove single genres
+// instead of replacing them all
+type patchInput struct {
+	Input
+	AddGenres    []string `json:"add_genres"`
+	RemoveGenres []string `json:"remove_genres"`
+}
+
+// changesGenres reports whether the patch adds or removes genres
+func (input patchInput) changesGenres() bool {
+	return len(input.AddGenres) > 0 || len(input.RemoveGenres) > 0
+}
+
+// onlyChangesGenres reports whether adding and removing genres is all the patch does
+func (input patchInput) onlyChangesGenres() bool {
+	return input.changesGenres() && input.Title == nil && input.Year == nil && input.Runtime == nil
+}
+
+// readUpdateInput reads the body of a PUT or PATCH, only a PATCH can add and remove genres
+func (app *application) readUpdateInput(w http.ResponseWriter, r *http.Request, partial bool) (patchInput, error) {
+	var input patchInput
+
+	if !partial {
+		err := app.readJSON(w, r, &input.Input)
+		return input, err
+	}
+
+	err := app.readJSON(w, r, &input)
+	return input, err
+}
+
+// validateUpdateInput checks the presence of the fields of a full replace and the genres
+// a patch adds and removes
+func (app *application) validateUpdateInput(v *validator.Validator, input patchInput, partial bool) error {
+	if !partial {
+		validateInputPresence(v, input.Input)
+		return nil
+	}
+
+	if !input.changesGenres() {
+		return nil
+	}
+
+	v.Check(!input.Genres.Set, "genres", "must not be combined with add_genres or remove_genres")
+
+	data.ValidateGenreChanges(v, input.AddGenres, input.RemoveGenres)
+
+	return app.validateKnownGenres(v, input.AddGenres)
+}
+
+func (app *application) replaceMovieHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateMovie(w, r, false)
+}
+
+func (app *application) patchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateMovie(w, r, true)
+}
+
+// updateMovie handles both PUT and PATCH. A partial update merges only the
+// fields present in the body, a full replace requires every field.
+func (app *application) updateMovie(w http.ResponseWriter, r *http.Request, partial bool) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	movie := &data.Movie{
-		Title:   *input.Title,
-		Year:    *input.Year,
-		Runtime: *input.Runtime,
-		Genres:  input.Genres,
+	switch r.Header.Get("X-Lock") {
+	case "", "optimistic":
+	case "pessimistic":
+		app.updateMovieLocked(w, r, id, partial)
+		return
+	default:
+		app.badRequestResponse(w, r, errors.New("X-Lock header must be optimistic or pessimistic"))
+		return
 	}
 
-	// Validation
-	v := validator.New()
+	// Fetch existing movie by Id
+	movie, err := app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if header := r.Header.Get("X-Expected-Version"); header != "" {
+		expectedVersion, err := strconv.ParseInt(header, 10, 32)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("X-Expected-Version header must be an integer"))
+			return
+		}
+
+		if int32(expectedVersion) != movie.Version {
+			app.editConflictResponse(w, r)
+			return
+		}
+	}
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !matchesMovieRevision(ifMatch, movie) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
-	// Insert to db
-	err = app.model.Movie.Insert(movie)
+	// Read JSON to input
+	input, err := app.readUpdateInput(w, r, partial)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	v := validator.New()
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	// A full replace must provide every field, a patch may add and remove genres
+	err = app.validateUpdateInput(v, input, partial)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
-}
 
-func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse Id
-	id, err := app.readIdParam(r)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Genres added and removed on their own are merged with the stored genres, so they do
+	// not conflict with other patches unless the request asked for a version
+	if input.onlyChangesGenres() {
+		var version int32
+
+		if r.Header.Get("X-Expected-Version") != "" || r.Header.Get("If-Match") != "" {
+			version = movie.Version
+		}
+
+		app.updateMovieGenres(w, r, movie.ID, version, input)
+		return
+	}
+
+	// Copy values from request body to movie
+	copyProperties(input.Input, movie)
+	movie.Genres = data.MergeGenres(movie.Genres, input.AddGenres, input.RemoveGenres)
+
+	// Validate movie to update
+	validateUpdatedMovie(v, movie, partial)
+
+	err = app.validateKnownGenres(v, movie.Genres)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Fetch existing movie by Id
-	movie, err := app.model.Movie.Get(id)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// Update movie
+	err = app.model.Movie.Update(movie)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateMovie):
+			v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if app.writeMinimal(w, r, http.StatusNoContent, headers) {
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse Id
-	id, err := app.readIdParam(r)
+// errMoviePrecondition and errMovieInvalid stop the transaction of updateMovieLocked
+// and updateMovieGenres once the response for them is known
+var (
+	errMoviePrecondition = errors.New("movie precondition failed")
+	errMovieInvalid      = errors.New("movie failed validation")
+)
+
+// updateMovieLocked handles "X-Lock: pessimistic", the movie stays locked from reading it
+// to saving it so concurrent editors are applied one after the other. The body is read
+// before taking the lock.
+func (app *application) updateMovieLocked(w http.ResponseWriter, r *http.Request, id int64, partial bool) {
+	var expectedVersion int64 = -1
+
+	if header := r.Header.Get("X-Expected-Version"); header != "" {
+		var err error
+
+		expectedVersion, err = strconv.ParseInt(header, 10, 32)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("X-Expected-Version header must be an integer"))
+			return
+		}
+	}
+
+	input, err := app.readUpdateInput(w, r, partial)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	// Fetch existing movie by Id
-	movie, err := app.model.Movie.Get(id)
+	v := validator.New()
+
+	err = app.validateUpdateInput(v, input, partial)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	movie, err := app.model.Movie.UpdateLocked(id, func(movie *data.Movie) error {
+		if expectedVersion != -1 && int32(expectedVersion) != movie.Version {
+			return data.ErrEditConflict
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !matchesMovieRevision(ifMatch, movie) {
+			return errMoviePrecondition
+		}
+
+		copyProperties(input.Input, movie)
+		movie.Genres = data.MergeGenres(movie.Genres, input.AddGenres, input.RemoveGenres)
+
+		validateUpdatedMovie(v, movie, partial)
+
+		err := app.validateKnownGenres(v, movie.Genres)
+		if err != nil {
+			return err
+		}
+
+		if !v.Valid() {
+			return errMovieInvalid
+		}
+
+		return nil
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, errMoviePrecondition):
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, errMovieInvalid):
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrDuplicateMovie):
+			v.AddErrorCode("title", validator.CodeDuplicate, "a movie with this title and year already exists")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	if expectedVersion := r.Header.Get("X-Expected-Version"); expectedVersion != "" && expectedVersion != strconv.FormatInt(int64(movie.Version), 32) {
-		app.editConflictResponse(w, r)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if app.writeMinimal(w, r, http.StatusNoContent, headers) {
 		return
 	}
 
-	// Read JSON to input
-	var input Input
-
-	err = app.readJSON(w, r, &input)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
 	}
+}
 
-	// Copy values from request body to movie
-	copyProperties(input, movie)
-
-	// Validate movie to update
+// updateMovieGenres answers a patch that only adds and removes genres, the merged genres
+// are validated before the update commits
+func (app *application) updateMovieGenres(w http.ResponseWriter, r *http.Request, id int64, version int32, input patchInput) {
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
-	}
 
-	// Update movie
-	err = app.model.Movie.Update(movie)
+	movie, err := app.model.Movie.UpdateGenres(id, version, input.AddGenres, input.RemoveGenres, func(movie *data.Movie) error {
+		if data.ValidatePatchedMovie(v, movie); !v.Valid() {
+			return errMovieInvalid
+		}
+
+		return nil
+	})
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, errMovieInvalid):
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	if app.writeMinimal(w, r, http.StatusNoContent, headers) {
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -152,30 +1070,111 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.model.Movie.Delete(id)
+	// With If-Match the movie is only deleted while it is still at that version
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseIfMatchVersion(ifMatch, id)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		err = app.model.Movie.DeleteVersioned(id, version)
+	} else {
+		err = app.model.Movie.Delete(id)
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 	// For machine
-	// err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+	// err = app.writeJSON(w, r, http.StatusNoContent, nil, nil)
 
 	// For human
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxBatchDelete caps how many movies a single batch delete may remove
+const maxBatchDelete = 100
+
+func (app *application) deleteMoviesBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.IDs) > 0, "ids", "must contain at least one id")
+	v.Check(len(input.IDs) <= maxBatchDelete, "ids", fmt.Sprintf("must not contain more than %d ids", maxBatchDelete))
+
+	for _, id := range input.IDs {
+		if id < 1 {
+			v.AddError("ids", "must only contain positive integers")
+			break
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	deleted, err := app.model.Movie.DeleteBatch(input.IDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	deletedSet := make(map[int64]bool, len(deleted))
+	for _, id := range deleted {
+		deletedSet[id] = true
+	}
+
+	notFound := []int64{}
+	for _, id := range input.IDs {
+		if !deletedSet[id] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"deleted": len(deleted), "not_found": notFound}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	app.listMovies(w, r, 0)
+}
+
+// listUserMoviesHandler lists the movies created by the authenticated user, with the
+// filters and pagination of the main listing
+func (app *application) listUserMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	app.listMovies(w, r, app.contextGetUser(r).ID)
+}
+
+// listMovies lists every movie, or only those created by the user with a userID other than zero
+func (app *application) listMovies(w http.ResponseWriter, r *http.Request, userID int64) {
 	var input struct {
 		Title  string
 		Genres []string
+		Fields []string
 		data.Filter
 	}
 
@@ -183,30 +1182,203 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	queryString := r.URL.Query()
 
-	input.Title = app.readString(queryString, "title", "")
-	input.Genres = app.readCSV(queryString, "genres", []string{})
+	input.Title, input.Genres, input.Filter = app.readMovieConditions(queryString, v)
+	input.Fields = app.readCSV(queryString, "fields", []string{})
+	input.Filter.Include = app.readCSV(queryString, "include", []string{})
 	input.Filter.Page = app.readInt(queryString, "page", 1, v)
-	input.Filter.PageSize = app.readInt(queryString, "page_size", 20, v)
-	input.Filter.Sort = app.readString(queryString, "sort", "id")
-	input.Filter.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filter.PageSize = app.readInt(queryString, "page_size", app.config.PageSizeDefault, v)
+	input.Filter.MaxPageSize = app.config.PageSizeMax
+	input.Filter.SortSafeList = []string{"id", "title", "year", "runtime", "rank", "similarity", "-id", "-title", "-year", "-runtime", "-rank", "-similarity"}
+
+	// A fuzzy search lists the closest titles first unless asked otherwise
+	defaultSort := "id"
+	if input.Filter.Query != "" {
+		defaultSort = "-similarity"
+	}
+	input.Filter.Sort = app.readString(queryString, "sort", defaultSort)
+	input.Filter.UseCursor = queryString.Has("cursor")
+	input.Filter.Cursor = app.readString(queryString, "cursor", "")
+
+	runtimeFormat := app.readRuntimeFormat(queryString, v)
+
+	if input.Filter.UseCursor && queryString.Has("page") {
+		v.AddError("cursor", "must not be used together with page")
+	}
+
+	for _, field := range input.Fields {
+		v.Check(validator.In(field, data.MovieFields...), "fields", fmt.Sprintf("invalid field %q", field))
+	}
 
 	if data.ValidateFilter(v, input.Filter); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	movies, metadata, err := app.model.Movie.GetAll(input.Title, input.Genres, input.Filter)
+	var (
+		movies   []*data.Movie
+		metadata data.Metadata
+		err      error
+	)
+
+	if userID != 0 {
+		movies, metadata, err = app.model.Movie.GetAllForUser(userID, input.Title, input.Genres, input.Filter)
+	} else {
+		movies, metadata, err = app.model.Movie.GetAll(input.Title, input.Genres, input.Filter)
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	for _, movie := range movies {
+		movie.RuntimeFormat = runtimeFormat
+	}
+
+	metadata.SetLinks(app.requestURL(r))
+
+	if wantsJSONAPI(r) {
+		resources := make([]jsonAPIResource, 0, len(movies))
+
+		for _, movie := range movies {
+			resource, err := movieResource(movie, input.Fields)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			resources = append(resources, resource)
+		}
+
+		// The links are top-level in JSON:API, the rest of the metadata is meta
+		links := metadata.Links
+		metadata.Links = nil
+
+		err = app.writeJSONAPI(w, http.StatusOK, jsonAPIDocument{Data: resources, Meta: map[string]interface{}{"pagination": metadata}, Links: links}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	env := envelope{
 		"metadata": metadata,
 		"movies":   movies,
 	}
-	err = app.writeJSON(w, http.StatusOK, env, nil)
+
+	if len(input.Fields) > 0 {
+		env["movies"], err = selectFields(movies, input.Fields)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) countMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	title, genres, filter := app.readMovieConditions(r.URL.Query(), v)
+
+	if data.ValidateConditions(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	count, err := app.model.Movie.Count(title, genres, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"count": count}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// exportMoviesHandler streams the movies matching the listing filters as CSV. Rows are
+// written while they are scanned, so once the first one is out errors can only be logged.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	title, genres, filter := app.readMovieConditions(r.URL.Query(), v)
+
+	if data.ValidateConditions(v, filter); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	csvWriter := csv.NewWriter(w)
+	started := false
+
+	start := func() error {
+		started = true
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+		w.WriteHeader(http.StatusOK)
+
+		return csvWriter.Write([]string{"id", "title", "year", "runtime", "genres"})
+	}
+
+	err := app.model.Movie.Stream(r.Context(), title, genres, filter, func(movie *data.Movie) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		return csvWriter.Write([]string{
+			strconv.FormatInt(movie.ID, 10),
+			movie.Title,
+			strconv.Itoa(int(movie.Year)),
+			strconv.Itoa(int(movie.Runtime)),
+			strings.Join(movie.Genres, "|"),
+		})
+	})
+	if err == nil && !started {
+		err = start()
+	}
+
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.logError(r, err)
+		return
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// readMovieConditions reads the query parameters narrowing down which movies are listed,
+// the returned filter holds no pagination or sorting
+func (app *application) readMovieConditions(queryString url.Values, v *validator.Validator) (string, []string, data.Filter) {
+	var filter data.Filter
+
+	title := app.readString(queryString, "title", "")
+	genres := app.readGenres(queryString, v)
+
+	filter.GenresMatch = app.readString(queryString, "genres_match", "all")
+	filter.YearFrom = app.readInt(queryString, "year_from", 0, v)
+	filter.YearTo = app.readInt(queryString, "year_to", 0, v)
+	filter.RuntimeMin = app.readInt(queryString, "runtime_min", 0, v)
+	filter.RuntimeMax = app.readInt(queryString, "runtime_max", 0, v)
+	filter.CreatedFrom = app.readDate(queryString, "created_from", time.Time{}, v)
+	filter.CreatedTo = app.readDate(queryString, "created_to", time.Time{}, v)
+	filter.Query = app.readString(queryString, "q", "")
+	filter.SimilarityThreshold = app.config.SearchThreshold
+
+	v.Check(validator.In(filter.GenresMatch, "all", "any"), "genres_match", "must be either all or any")
+
+	return title, genres, filter
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceMovieRequiresEveryField(t *testing.T) {
+	app := newTestApplication(t)
+	movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodPut, "/v1/movies/1", `{"title":"Gladiator","year":2000,"genres":["action"]}`))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+
+	fields := fieldErrors(t, rr)
+
+	assert.Equal(t, "must be provided", fields["runtime"])
+
+	stored, err := app.model.Movie.Get(movie.ID)
+	require.NoError(t, err)
+	assert.Equal(t, movie.Version, stored.Version)
+}
+
+func TestPatchMovieKeepsOmittedFields(t *testing.T) {
+	app := newTestApplication(t)
+	movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodPatch, "/v1/movies/1", `{"title":"Gladiator (Extended)"}`))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response struct {
+		Movie data.Movie `json:"movie"`
+	}
+	decodeJSON(t, rr, &response)
+
+	assert.Equal(t, "Gladiator (Extended)", response.Movie.Title)
+	assert.Equal(t, data.Runtime(155), response.Movie.Runtime)
+
+	stored, err := app.model.Movie.Get(movie.ID)
+	require.NoError(t, err)
+	assert.Equal(t, data.Runtime(155), stored.Runtime)
+	assert.Equal(t, movie.Version+1, stored.Version)
+}
+
+func TestCreateMovieRequiresFields(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/movies", `{}`))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+
+	fields := fieldErrors(t, rr)
+
+	for _, field := range []string{"title", "year", "runtime", "genres"} {
+		assert.Equal(t, "must be provided", fields[field], field)
+	}
+}
+
+func TestShowMovie(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{name: "existing", target: "/v1/movies/1", wantStatus: http.StatusOK},
+		{name: "missing", target: "/v1/movies/42", wantStatus: http.StatusNotFound},
+		{name: "invalid id", target: "/v1/movies/-1", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, tt.target, ""))
+
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Movie data.Movie `json:"movie"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.Equal(t, "Gladiator", response.Movie.Title)
+			assert.Equal(t, []string{"action", "drama"}, response.Movie.Genres)
+		})
+	}
+}
+
+func TestDeleteMovie(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodDelete, "/v1/movies/1", ""))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	_, err := app.model.Movie.Get(1)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	rr = serve(app, newTestRequest(t, http.MethodDelete, "/v1/movies/1", ""))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestListMovies(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+	insertTestMovie(t, app, "The Matrix", 1999, 136, "action", "sci-fi")
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies?genres=drama&page_size=1", ""))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response struct {
+		Metadata data.Metadata `json:"metadata"`
+		Movies   []data.Movie  `json:"movies"`
+	}
+	decodeJSON(t, rr, &response)
+
+	require.Len(t, response.Movies, 1)
+	assert.Equal(t, "Gladiator", response.Movies[0].Title)
+	assert.Equal(t, 2, response.Metadata.TotalRecords)
+}
+
+func TestPatchMovieGenres(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantGenres []string
+	}{
+		{name: "absent", body: `{"title":"Gladiator (Extended)"}`, wantGenres: []string{"action", "drama"}},
+		{name: "null", body: `{"genres":null}`, wantGenres: []string{}},
+		{name: "value", body: `{"genres":["history"]}`, wantGenres: []string{"history"}},
+		{name: "remove every genre", body: `{"remove_genres":["action","drama"]}`, wantGenres: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+			rr := serve(app, newTestRequest(t, http.MethodPatch, "/v1/movies/1", tt.body))
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response struct {
+				Movie data.Movie `json:"movie"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.Equal(t, tt.wantGenres, response.Movie.Genres)
+
+			stored, err := app.model.Movie.Get(movie.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantGenres, stored.Genres)
+		})
+	}
+}
+
+func TestPatchMovieGenreChangesConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	bodies := []string{
+		`{"add_genres":["history"]}`,
+		`{"add_genres":["war"]}`,
+		`{"add_genres":["epic"]}`,
+		`{"remove_genres":["drama"]}`,
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(bodies))
+
+	for i, body := range bodies {
+		wg.Add(1)
+
+		go func(i int, body string) {
+			defer wg.Done()
+
+			codes[i] = serve(app, newTestRequest(t, http.MethodPatch, "/v1/movies/1", body)).Code
+		}(i, body)
+	}
+
+	wg.Wait()
+
+	for i, code := range codes {
+		assert.Equal(t, http.StatusOK, code, bodies[i])
+	}
+
+	stored, err := app.model.Movie.Get(movie.ID)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"action", "history", "war", "epic"}, stored.Genres)
+	assert.Equal(t, movie.Version+int32(len(bodies)), stored.Version)
+}
+
+func TestPatchMovieGenreChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		header     string
+		wantStatus int
+		wantGenres []string
+		wantErrors map[string]string
+	}{
+		{name: "add and remove", body: `{"add_genres":["noir"],"remove_genres":["drama"]}`, wantStatus: http.StatusOK, wantGenres: []string{"action", "noir"}},
+		{name: "add already set", body: `{"add_genres":["drama","noir"]}`, wantStatus: http.StatusOK, wantGenres: []string{"action", "drama", "noir"}},
+		{name: "remove missing", body: `{"remove_genres":["crime"]}`, wantStatus: http.StatusOK, wantGenres: []string{"action", "drama"}},
+		{name: "current version", body: `{"add_genres":["noir"]}`, header: "1", wantStatus: http.StatusOK, wantGenres: []string{"action", "drama", "noir"}},
+		{name: "stale version", body: `{"add_genres":["noir"]}`, header: "7", wantStatus: http.StatusConflict},
+		{name: "combined with genres", body: `{"genres":["war"],"add_genres":["noir"]}`, wantStatus: http.StatusUnprocessableEntity, wantErrors: map[string]string{"genres": "must not be combined with add_genres or remove_genres"}},
+		{name: "added and removed", body: `{"add_genres":["noir"],"remove_genres":["noir"]}`, wantStatus: http.StatusUnprocessableEntity, wantErrors: map[string]string{"remove_genres": `must not contain "noir" which is also added`}},
+		{name: "duplicate", body: `{"add_genres":["noir","noir"]}`, wantStatus: http.StatusUnprocessableEntity, wantErrors: map[string]string{"add_genres": "must not contain duplicate values"}},
+		{name: "too many merged", body: `{"add_genres":["noir","war","epic","crime"]}`, wantStatus: http.StatusUnprocessableEntity, wantErrors: map[string]string{"genres": "must not contain more than 5 genres"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+			r := newTestRequest(t, http.MethodPatch, "/v1/movies/1", tt.body)
+			if tt.header != "" {
+				r.Header.Set("X-Expected-Version", tt.header)
+			}
+
+			rr := serve(app, r)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantErrors != nil {
+				assert.Equal(t, tt.wantErrors, fieldErrors(t, rr))
+			}
+
+			stored, err := app.model.Movie.Get(movie.ID)
+			require.NoError(t, err)
+
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantGenres, stored.Genres)
+			} else {
+				assert.Equal(t, []string{"action", "drama"}, stored.Genres)
+			}
+		})
+	}
+}
+
+func TestReplaceMovieRequiresGenres(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodPut, "/v1/movies/1", `{"title":"Gladiator","year":2000,"runtime":"155 mins","genres":[]}`))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	assert.Equal(t, "must contain at least 1 genres", fieldErrors(t, rr)["genres"])
+}
+
+func TestUpdateMovieExpectedVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     func(movie *data.Movie) string
+		wantStatus int
+	}{
+		{name: "matching", header: func(movie *data.Movie) string { return strconv.Itoa(int(movie.Version)) }, wantStatus: http.StatusOK},
+		{name: "stale", header: func(movie *data.Movie) string { return strconv.Itoa(int(movie.Version) - 1) }, wantStatus: http.StatusConflict},
+		{name: "garbage", header: func(movie *data.Movie) string { return "v1" }, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			movie := insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+			r := newTestRequest(t, http.MethodPatch, "/v1/movies/1", `{"title":"Gladiator (Extended)"}`)
+			r.Header.Set("X-Expected-Version", tt.header(movie))
+
+			rr := serve(app, r)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			stored, err := app.model.Movie.Get(movie.ID)
+			require.NoError(t, err)
+
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, movie.Version+1, stored.Version)
+			} else {
+				assert.Equal(t, movie.Version, stored.Version)
+			}
+		})
+	}
+}
+
+func TestShowMovieETag(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+	rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies/1", ""))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	etag := rr.Header().Get("ETag")
+	assert.Regexp(t, `^W/"1-1-[0-9a-f]{16}"$`, etag)
+	assert.Contains(t, rr.Header().Values("Vary"), "Authorization")
+
+	r := newTestRequest(t, http.MethodGet, "/v1/movies/1", "")
+	r.Header.Set("If-None-Match", etag)
+
+	rr = serve(app, r)
+	require.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	assert.Contains(t, rr.Header().Values("Vary"), "Authorization")
+	assert.Empty(t, rr.Body.String())
+
+	// Favoriting changes favorite_count and is_favorite but not the movie version
+	require.NoError(t, app.model.Favorite.Add(testUser.ID, 1))
+
+	r = newTestRequest(t, http.MethodGet, "/v1/movies/1", "")
+	r.Header.Set("If-None-Match", etag)
+
+	rr = serve(app, r)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+
+	var response struct {
+		FavoriteCount int  `json:"favorite_count"`
+		IsFavorite    bool `json:"is_favorite"`
+	}
+	decodeJSON(t, rr, &response)
+	assert.Equal(t, 1, response.FavoriteCount)
+	assert.True(t, response.IsFavorite)
+}
+
+// The ETag of the movie detail still names the movie revision in an If-Match
+func TestShowMovieETagIfMatch(t *testing.T) {
+	tests := []struct {
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{method: http.MethodPatch, body: `{"title":"Gladiator (Extended)"}`, wantStatus: http.StatusOK},
+		{method: http.MethodPut, body: `{"title":"Gladiator","year":2000,"runtime":"155 mins","genres":["action"]}`, wantStatus: http.StatusOK},
+		{method: http.MethodDelete, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			app := newTestApplication(t)
+			insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+
+			rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies/1", ""))
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			etag := rr.Header().Get("ETag")
+
+			r := newTestRequest(t, tt.method, "/v1/movies/1", tt.body)
+			r.Header.Set("If-Match", etag)
+
+			rr = serve(app, r)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			// The movie moved on to a new revision, the old ETag no longer matches
+			if tt.method != http.MethodDelete {
+				r = newTestRequest(t, tt.method, "/v1/movies/1", tt.body)
+				r.Header.Set("If-Match", etag)
+
+				rr = serve(app, r)
+				assert.Equal(t, http.StatusPreconditionFailed, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestShowMovieRuntimeFormat(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 107, "action", "drama")
+
+	tests := []struct {
+		target      string
+		wantRuntime string
+	}{
+		{target: "/v1/movies/1", wantRuntime: "107 mins"},
+		{target: "/v1/movies/1?runtime_format=iso8601", wantRuntime: "PT1H47M"},
+		{target: "/v1/movies?runtime_format=iso8601", wantRuntime: "PT1H47M"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, tt.target, ""))
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response struct {
+				Movie  map[string]interface{}   `json:"movie"`
+				Movies []map[string]interface{} `json:"movies"`
+			}
+			decodeJSON(t, rr, &response)
+
+			movie := response.Movie
+			if movie == nil {
+				require.Len(t, response.Movies, 1)
+				movie = response.Movies[0]
+			}
+
+			assert.Equal(t, tt.wantRuntime, movie["runtime"])
+		})
+	}
+}
+
+func TestListMoviesPageSizeLimits(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.PageSizeDefault = 2
+	app.config.PageSizeMax = 3
+
+	for _, title := range []string{"Gladiator", "The Matrix", "Heat", "Alien"} {
+		insertTestMovie(t, app, title, 1999, 120, "action")
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantMovies int
+	}{
+		{name: "default", target: "/v1/movies", wantStatus: http.StatusOK, wantMovies: 2},
+		{name: "maximum", target: "/v1/movies?page_size=3", wantStatus: http.StatusOK, wantMovies: 3},
+		{name: "over maximum", target: "/v1/movies?page_size=4", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, tt.target, ""))
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, "must be a maximum of 3", fieldErrors(t, rr)["page_size"])
+				return
+			}
+
+			var response struct {
+				Movies []data.Movie `json:"movies"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.Len(t, response.Movies, tt.wantMovies)
+		})
+	}
+}
+
+func TestSimilarMoviesLimit(t *testing.T) {
+	app := newTestApplication(t)
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action", "drama")
+	insertTestMovie(t, app, "Troy", 2004, 163, "action", "drama")
+	insertTestMovie(t, app, "Braveheart", 1995, 178, "action", "drama")
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime", "drama")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantMovies int
+		wantError  string
+	}{
+		{name: "no limit", query: "", wantStatus: http.StatusOK, wantMovies: 3},
+		{name: "limit", query: "?limit=2", wantStatus: http.StatusOK, wantMovies: 2},
+		{name: "zero", query: "?limit=0", wantStatus: http.StatusUnprocessableEntity, wantError: "must be between 1 and 20"},
+		{name: "too large", query: "?limit=21", wantStatus: http.StatusUnprocessableEntity, wantError: "must be between 1 and 20"},
+		{name: "not an integer", query: "?limit=two", wantStatus: http.StatusUnprocessableEntity, wantError: "must be an integer value"},
+		{name: "with page_size", query: "?limit=2&page_size=2", wantStatus: http.StatusUnprocessableEntity, wantError: "must not be combined with page_size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/movies/1/similar"+tt.query, ""))
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, tt.wantError, fieldErrors(t, rr)["limit"])
+				return
+			}
+
+			var response struct {
+				Movies []data.Movie `json:"movies"`
+			}
+			decodeJSON(t, rr, &response)
+
+			assert.Len(t, response.Movies, tt.wantMovies)
+		})
+	}
+}
+
+func TestCreateMovieLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		baseURL      string
+		wantLocation string
+		wantNext     string
+	}{
+		{name: "relative", wantLocation: "/v1/movies/1", wantNext: "http://example.com/v1/movies?page=2&page_size=1"},
+		{name: "absolute", baseURL: "https://api.example.org/", wantLocation: "https://api.example.org/v1/movies/1", wantNext: "https://api.example.org/v1/movies?page=2&page_size=1"},
+		{name: "absolute with path", baseURL: "https://example.org/api", wantLocation: "https://example.org/api/v1/movies/1", wantNext: "https://example.org/api/v1/movies?page=2&page_size=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.BaseURL = tt.baseURL
+
+			rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/movies", `{"title":"Gladiator","year":2000,"runtime":"155 mins","genres":["action"]}`))
+			require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+
+			// The pagination links use the same base URL
+			insertTestMovie(t, app, "Heat", 1995, 170, "crime")
+
+			rr = serve(app, newTestRequest(t, http.MethodGet, "/v1/movies?page_size=1", ""))
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response struct {
+				Metadata data.Metadata `json:"metadata"`
+			}
+			decodeJSON(t, rr, &response)
+
+			require.NotNil(t, response.Metadata.Links)
+			require.NotNil(t, response.Metadata.Links.Next)
+			assert.Equal(t, tt.wantNext, *response.Metadata.Links.Next)
+		})
+	}
+}
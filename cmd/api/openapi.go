@@ -0,0 +1,608 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/harryng22/moviedb/internal/data"
+)
+
+// The OpenAPI 3.0 document is built by hand from these types, keep it in step with routes.go
+
+type openAPIDocument struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       openAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]openAPIOp `json:"paths"`
+	Components openAPIComponents               `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+
+	// DisabledFeatures lists the features whose routes are switched off on this server
+	DisabledFeatures []string `json:"x-disabled-features,omitempty"`
+}
+
+type openAPIOp struct {
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Example              interface{}               `json:"example,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Maximum              *int                      `json:"maximum,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]map[string]interface{} `json:"securitySchemes"`
+}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func schemaIntRange(min, max int) *openAPISchema {
+	return &openAPISchema{Type: "integer", Minimum: &min, Maximum: &max}
+}
+
+func jsonContent(schema *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+func envelopeOf(key string, schema *openAPISchema) *openAPISchema {
+	return &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{key: schema}}
+}
+
+func jsonBody(schema *openAPISchema) *openAPIRequestBody {
+	return &openAPIRequestBody{Required: true, Content: jsonContent(schema)}
+}
+
+func queryParam(name, description string, schema *openAPISchema) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+var (
+	idParam          = openAPIParameter{Name: "id", In: "path", Required: true, Schema: &openAPISchema{Type: "integer", Format: "int64"}}
+	lockParam        = openAPIParameter{Name: "X-Lock", In: "header", Description: "pessimistic makes concurrent updates wait instead of conflicting", Schema: &openAPISchema{Type: "string", Enum: []string{"optimistic", "pessimistic"}}}
+	genresDelimParam = queryParam("genres_delim", "Separator of the genres", &openAPISchema{Type: "string", Enum: []string{",", "|", ";"}})
+
+	bearerAuth = []map[string][]string{{"bearerAuth": {}}}
+
+	apiError = openAPIResponse{Description: "Error", Content: jsonContent(schemaRef("Error"))}
+
+	apiValidationError = openAPIResponse{Description: "Failed validation", Content: jsonContent(schemaRef("ValidationError"))}
+
+	apiMovie = openAPIResponse{Description: "The movie", Content: jsonContent(envelopeOf("movie", schemaRef("Movie")))}
+
+	apiMovies = openAPIResponse{Description: "The movies", Content: jsonContent(envelopeOf("movies", &openAPISchema{Type: "array", Items: schemaRef("Movie")}))}
+)
+
+// movieConditionParams are the filters shared by the listing, count and export routes
+func movieConditionParams() []openAPIParameter {
+	return []openAPIParameter{
+		queryParam("title", "Full-text search on the title", &openAPISchema{Type: "string"}),
+		queryParam("q", "Fuzzy search on the title tolerating typos", &openAPISchema{Type: "string", Example: "gladaitor"}),
+		queryParam("genres", "Genres separated by genres_delim", &openAPISchema{Type: "string", Example: "drama,sci-fi"}),
+		genresDelimParam,
+		queryParam("genres_match", "Whether a movie needs all or any of the genres", &openAPISchema{Type: "string", Enum: []string{"all", "any"}}),
+		queryParam("year_from", "", &openAPISchema{Type: "integer"}),
+		queryParam("year_to", "", &openAPISchema{Type: "integer"}),
+		queryParam("runtime_min", "Minutes", &openAPISchema{Type: "integer"}),
+		queryParam("runtime_max", "Minutes", &openAPISchema{Type: "integer"}),
+		queryParam("created_from", "", &openAPISchema{Type: "string", Format: "date-time"}),
+		queryParam("created_to", "", &openAPISchema{Type: "string", Format: "date-time"}),
+	}
+}
+
+func (app *application) openAPISpec() openAPIDocument {
+	pageParam := queryParam("page", "", schemaIntRange(1, 10_000_000))
+	pageSizeParam := queryParam("page_size", "", schemaIntRange(1, app.config.PageSizeMax))
+
+	listParams := append(movieConditionParams(),
+		pageParam,
+		pageSizeParam,
+		queryParam("sort", "Comma separated keys, prefix with - to sort descending, -similarity by default with q", &openAPISchema{Type: "string", Example: "-year,title"}),
+		queryParam("cursor", "Paginate by cursor instead of page, sort must be id", &openAPISchema{Type: "string"}),
+		queryParam("fields", "Comma separated fields to return", &openAPISchema{Type: "string"}),
+		queryParam("include", "Comma separated counts to add to each movie, rating_count and cast_count", &openAPISchema{Type: "string", Example: "rating_count,cast_count"}),
+	)
+
+	movieInput := schemaRef("MovieInput")
+
+	return openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "MovieDB API", Version: buildVersion(), DisabledFeatures: app.features.Disabled()},
+		Paths: map[string]map[string]openAPIOp{
+			"/v1/healthcheck": {
+				"get": {Summary: "Report the availability of the API", Responses: map[string]openAPIResponse{"200": {Description: "Available"}, "503": {Description: "Database unreachable"}}},
+			},
+			"/v1/openapi.json": {
+				"get": {Summary: "This document", Responses: map[string]openAPIResponse{"200": {Description: "The OpenAPI document"}}},
+			},
+			"/v1/debug/vars": {
+				"get": {Summary: "Report the build version, runtime and non-secret settings", Security: bearerAuth, Responses: map[string]openAPIResponse{"200": {Description: "The debug variables"}, "403": apiError}},
+			},
+			"/v1/movies": {
+				"get": {
+					Summary:    "List movies",
+					Parameters: listParams,
+					Security:   bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "A page of movies", Content: jsonContent(&openAPISchema{Type: "object", Properties: map[string]*openAPISchema{
+							"movies":   {Type: "array", Items: schemaRef("Movie")},
+							"metadata": schemaRef("Metadata"),
+						}})},
+						"422": apiValidationError,
+					},
+				},
+				"post": {
+					Summary: "Create a movie",
+					Parameters: []openAPIParameter{
+						{Name: "Idempotency-Key", In: "header", Schema: &openAPISchema{Type: "string"}},
+						{Name: "If-None-Match", In: "header", Description: "* only creates the movie when no movie has its external_id", Schema: &openAPISchema{Type: "string", Enum: []string{"*"}}},
+					},
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Properties: map[string]*openAPISchema{
+						"title":       {Type: "string"},
+						"year":        {Type: "integer"},
+						"runtime":     {Type: "string", Example: "1h47m"},
+						"genres":      {Type: "array", Items: &openAPISchema{Type: "string"}},
+						"external_id": {Type: "string", Pattern: data.ExternalIDRX.String(), Example: "imdb:tt0133093"},
+					}}),
+					Security:  bearerAuth,
+					Responses: map[string]openAPIResponse{"201": apiMovie, "400": apiError, "409": {Description: "A movie has the external_id, Location names it", Content: jsonContent(schemaRef("Error"))}, "422": apiValidationError},
+				},
+				"delete": {
+					Summary:     "Delete several movies",
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Required: []string{"ids"}, Properties: map[string]*openAPISchema{"ids": {Type: "array", Items: &openAPISchema{Type: "integer", Format: "int64"}}}}),
+					Security:    bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "Deleted movies", Content: jsonContent(&openAPISchema{Type: "object", Properties: map[string]*openAPISchema{
+							"deleted":   {Type: "integer"},
+							"not_found": {Type: "array", Items: &openAPISchema{Type: "integer", Format: "int64"}},
+						}})},
+						"422": apiValidationError,
+					},
+				},
+			},
+			"/v1/movies/bulk": {
+				"post": {
+					Summary:     "Create several movies in one transaction",
+					RequestBody: jsonBody(&openAPISchema{Type: "array", Items: movieInput}),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"201": apiMovies, "422": {Description: "Validation errors keyed by array index"}},
+				},
+			},
+			"/v1/movies/import": {
+				"post": {
+					Summary: "Import movies from a CSV file with the title, year, runtime and genres columns, genres separated by |",
+					RequestBody: &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{"multipart/form-data": {Schema: &openAPISchema{
+						Type:       "object",
+						Required:   []string{"file"},
+						Properties: map[string]*openAPISchema{"file": {Type: "string", Format: "binary"}},
+					}}}},
+					Security: bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The number of imported movies and the line and error of every skipped row"},
+						"400": apiError,
+						"422": apiValidationError,
+					},
+				},
+			},
+			"/v1/movies/count": {
+				"get": {
+					Summary:    "Count the movies matching the filters",
+					Parameters: movieConditionParams(),
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The count", Content: jsonContent(envelopeOf("count", &openAPISchema{Type: "integer"}))}, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/export.csv": {
+				"get": {
+					Summary:    "Export the movies matching the filters as CSV",
+					Parameters: movieConditionParams(),
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "id,title,year,runtime,genres rows", Content: map[string]openAPIMediaType{"text/csv": {Schema: &openAPISchema{Type: "string"}}}}, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/random": {
+				"get": {
+					Summary:    "Return a random movie",
+					Parameters: []openAPIParameter{queryParam("genres", "Genres separated by genres_delim", &openAPISchema{Type: "string"}), genresDelimParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": apiMovie, "404": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/stream": {
+				"get": {
+					Summary:   "Stream the created movies as server-sent movie events",
+					Security:  bearerAuth,
+					Responses: map[string]openAPIResponse{"200": {Description: "An event stream, each event holds a movie", Content: map[string]openAPIMediaType{"text/event-stream": {Schema: &openAPISchema{Type: "string"}}}}, "503": apiError},
+				},
+			},
+			"/v1/movies/compare": {
+				"get": {
+					Summary:    "Compare 2 to 5 movies side by side",
+					Parameters: []openAPIParameter{{Name: "ids", In: "query", Required: true, Description: "Comma separated movie ids", Schema: &openAPISchema{Type: "string", Example: "1,2"}}},
+					Security:   bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The movies and their shared genres, runtime difference and year difference"},
+						"404": {Description: "Movies not found, missing_ids lists them"},
+						"422": apiValidationError,
+					},
+				},
+			},
+			"/v1/movies/by-slug/{slug}": {
+				"get": {
+					Summary:    "Show a movie by its slug",
+					Parameters: []openAPIParameter{{Name: "slug", In: "path", Required: true, Schema: &openAPISchema{Type: "string", Example: "dune-2021"}}},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": apiMovie, "404": apiError},
+				},
+			},
+			"/v1/movies/external/{external_id}": {
+				"put": {
+					Summary:     "Create or replace the movie with an external id",
+					Parameters:  []openAPIParameter{{Name: "external_id", In: "path", Required: true, Schema: &openAPISchema{Type: "string", Pattern: data.ExternalIDRX.String(), Example: "tmdb:603"}}},
+					RequestBody: jsonBody(movieInput),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"200": apiMovie, "201": apiMovie, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}": {
+				"get": {
+					Summary:    "Show a movie with its rating and cast",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": apiMovie, "304": {Description: "Not modified"}, "404": apiError},
+				},
+				"put": {
+					Summary:     "Replace a movie",
+					Parameters:  []openAPIParameter{idParam, lockParam},
+					RequestBody: jsonBody(movieInput),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"200": apiMovie, "404": apiError, "409": apiError, "412": apiError, "422": apiValidationError},
+				},
+				"patch": {
+					Summary:     "Update some fields of a movie, a null genres clears them and add_genres or remove_genres merge single genres",
+					Parameters:  []openAPIParameter{idParam, lockParam},
+					RequestBody: jsonBody(schemaRef("MoviePatch")),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"200": apiMovie, "404": apiError, "409": apiError, "412": apiError, "422": apiValidationError},
+				},
+				"delete": {
+					Summary:    "Delete a movie",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "Deleted"}, "404": apiError},
+				},
+			},
+			"/v1/movies/{id}/similar": {
+				"get": {
+					Summary:    "List the movies sharing the most genres",
+					Parameters: []openAPIParameter{idParam, pageParam, pageSizeParam, queryParam("limit", "Size of the first page, cannot be combined with page_size", schemaIntRange(1, 20))},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": apiMovies, "404": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}/history": {
+				"get": {
+					Summary:    "List the earlier versions of a movie, oldest first, also after it was deleted",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The movie versions"}, "404": apiError},
+				},
+			},
+			"/v1/movies/{id}/rating": {
+				"put": {
+					Summary:     "Rate a movie",
+					Parameters:  []openAPIParameter{idParam},
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Properties: map[string]*openAPISchema{"score": schemaIntRange(1, 10)}}),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"200": {Description: "The rating"}, "404": apiError, "409": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}/watched": {
+				"put": {
+					Summary:     "Mark a movie watched or unwatched",
+					Parameters:  []openAPIParameter{idParam},
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Required: []string{"watched"}, Properties: map[string]*openAPISchema{"watched": {Type: "boolean"}}}),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"200": {Description: "The watched state"}, "404": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}/favorite": {
+				"post": {
+					Summary:    "Favorite a movie, favoriting it again changes nothing",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The favorite state and count"}, "404": apiError},
+				},
+				"delete": {
+					Summary:    "Unfavorite a movie",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The favorite state and count"}, "404": apiError},
+				},
+			},
+			"/v1/movies/{id}/poster": {
+				"get": {
+					Summary:    "Download the poster of a movie, cacheable with its ETag",
+					Parameters: []openAPIParameter{idParam},
+					Responses:  map[string]openAPIResponse{"200": {Description: "The JPEG or PNG poster"}, "304": {Description: "Not modified"}, "404": apiError},
+				},
+				"post": {
+					Summary:    "Upload a JPEG or PNG poster as the multipart poster field",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The poster URL"}, "404": apiError, "413": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}/cast": {
+				"get": {
+					Summary:    "List the cast of a movie by actor name",
+					Parameters: []openAPIParameter{idParam, pageParam, pageSizeParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The cast members with pagination metadata"}, "404": apiError, "422": apiValidationError},
+				},
+				"post": {
+					Summary:    "Add an actor to the cast of a movie",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"201": {Description: "The cast member"}, "404": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/movies/{id}/export.json": {
+				"get": {
+					Summary:    "Download a movie as an indented JSON file",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": apiMovie, "404": apiError},
+				},
+			},
+			"/v1/movies/{id}/recommendations": {
+				"get": {
+					Summary:    "Recommend the movies rated highly by the users who rated this movie highly",
+					Parameters: []openAPIParameter{idParam, queryParam("limit", "", schemaIntRange(1, 20))},
+					Security:   bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The movies, genre_fallback tells whether movies sharing genres topped up too few ratings"},
+						"404": apiError,
+						"422": apiValidationError,
+					},
+				},
+			},
+			"/v1/movies/{id}/reviews": {
+				"get": {
+					Summary:    "List the approved reviews of a movie, admin:read also lists the unapproved ones",
+					Parameters: []openAPIParameter{idParam, pageParam, pageSizeParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The reviews with pagination metadata"}, "404": apiError, "422": apiValidationError},
+				},
+				"post": {
+					Summary:     "Review a movie, the review is listed once approved",
+					Parameters:  []openAPIParameter{idParam},
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Required: []string{"body"}, Properties: map[string]*openAPISchema{"body": {Type: "string", Description: "1 to 5000 characters"}}}),
+					Security:    bearerAuth,
+					Responses:   map[string]openAPIResponse{"201": {Description: "The review"}, "404": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/reviews/{id}": {
+				"delete": {
+					Summary:    "Delete a review, only its author or admin:write may",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "Deleted"}, "403": apiError, "404": apiError},
+				},
+			},
+			"/v1/reviews/{id}/approved": {
+				"put": {
+					Summary:    "Approve a review",
+					Parameters: []openAPIParameter{idParam},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The approved review"}, "403": apiError, "404": apiError, "409": apiError},
+				},
+			},
+			"/v1/genres": {
+				"get": {Summary: "List the known genres", Security: bearerAuth, Responses: map[string]openAPIResponse{"200": {Description: "The genres"}}},
+			},
+			"/v1/genres/stats": {
+				"get": {
+					Summary:    "Count the movies of each genre",
+					Parameters: []openAPIParameter{queryParam("min_count", "Leave out genres on fewer movies", &openAPISchema{Type: "integer"})},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "Movie counts keyed by genre", Content: jsonContent(envelopeOf("stats", &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{Type: "integer"}}))}, "422": apiValidationError},
+				},
+			},
+			"/v1/genres/rename": {
+				"post": {
+					Summary: "Rename a genre in every movie and in the canonical genres",
+					RequestBody: jsonBody(&openAPISchema{Type: "object", Required: []string{"from", "to"}, Properties: map[string]*openAPISchema{
+						"from": {Type: "string", Example: "sci-fi"},
+						"to":   {Type: "string", Example: "science fiction"},
+					}}),
+					Security:  bearerAuth,
+					Responses: map[string]openAPIResponse{"200": {Description: "The number of updated movies"}, "403": apiError, "422": apiValidationError},
+				},
+			},
+			"/v1/years": {
+				"get": {
+					Summary: "Count the movies of each release year, latest first",
+					Parameters: []openAPIParameter{
+						queryParam("genres", "Only count movies having all of these genres, separated by genres_delim", &openAPISchema{Type: "string"}),
+						genresDelimParam,
+					},
+					Security:  bearerAuth,
+					Responses: map[string]openAPIResponse{"200": {Description: "Years with their movie count"}, "422": apiValidationError},
+				},
+			},
+			"/v1/stats/dashboard": {
+				"get": {
+					Summary:   "Catalogue totals for the admin dashboard, cached for DASHBOARD_CACHE_TTL",
+					Security:  bearerAuth,
+					Responses: map[string]openAPIResponse{"200": {Description: "Total movies, average runtime, year bounds, movies per decade and the 5 most common genres"}, "403": apiError},
+				},
+			},
+			"/v1/actors": {
+				"post": {Summary: "Create an actor", Security: bearerAuth, Responses: map[string]openAPIResponse{"201": {Description: "The actor"}, "422": apiValidationError}},
+			},
+			"/v1/actors/{id}": {
+				"get":    {Summary: "Show an actor", Parameters: []openAPIParameter{idParam}, Security: bearerAuth, Responses: map[string]openAPIResponse{"200": {Description: "The actor"}, "404": apiError}},
+				"patch":  {Summary: "Update an actor", Parameters: []openAPIParameter{idParam}, Security: bearerAuth, Responses: map[string]openAPIResponse{"200": {Description: "The actor"}, "404": apiError, "409": apiError, "422": apiValidationError}},
+				"delete": {Summary: "Delete an actor", Parameters: []openAPIParameter{idParam}, Security: bearerAuth, Responses: map[string]openAPIResponse{"200": {Description: "Deleted"}, "404": apiError}},
+			},
+			"/v1/user/movies": {
+				"get": {
+					Summary:    "List the movies created by the authenticated user",
+					Parameters: listParams,
+					Security:   bearerAuth,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "A page of movies", Content: jsonContent(&openAPISchema{Type: "object", Properties: map[string]*openAPISchema{
+							"movies":   {Type: "array", Items: schemaRef("Movie")},
+							"metadata": schemaRef("Metadata"),
+						}})},
+						"422": apiValidationError,
+					},
+				},
+			},
+			"/v1/user/watchlist": {
+				"get": {
+					Summary:    "List the watchlist of the authenticated user",
+					Parameters: []openAPIParameter{queryParam("watched", "", &openAPISchema{Type: "boolean"})},
+					Security:   bearerAuth,
+					Responses:  map[string]openAPIResponse{"200": {Description: "The watchlist"}, "422": apiValidationError},
+				},
+			},
+			"/v1/users": {
+				"post": {Summary: "Register a user", Responses: map[string]openAPIResponse{"202": {Description: "Registered, activation pending"}, "422": apiValidationError}},
+			},
+			"/v1/users/activated": {
+				"put": {Summary: "Activate a user with the emailed token", Responses: map[string]openAPIResponse{"200": {Description: "Activated"}, "422": apiValidationError}},
+			},
+			"/v1/tokens/authentication": {
+				"post": {Summary: "Create an authentication token", Responses: map[string]openAPIResponse{"201": {Description: "The token"}, "401": apiError, "422": apiValidationError}},
+			},
+		},
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"Runtime": {Type: "string", Pattern: "^[0-9]+ mins$", Example: "107 mins", Description: "Runtime in minutes"},
+				"Movie": {
+					Type:     "object",
+					Required: []string{"id", "title", "genres", "version"},
+					Properties: map[string]*openAPISchema{
+						"id":           {Type: "integer", Format: "int64"},
+						"create_at":    {Type: "string", Format: "date-time"},
+						"title":        {Type: "string"},
+						"slug":         {Type: "string"},
+						"external_id":  {Type: "string"},
+						"year":         {Type: "integer"},
+						"runtime":      schemaRef("Runtime"),
+						"genres":       {Type: "array", Items: &openAPISchema{Type: "string"}},
+						"version":      {Type: "integer"},
+						"rating_count": {Type: "integer", Description: "Only listed with include"},
+						"cast_count":   {Type: "integer", Description: "Only listed with include"},
+					},
+				},
+				"MovieInput": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"title":   {Type: "string"},
+						"year":    {Type: "integer"},
+						"runtime": {Type: "string", Example: "1h47m", Description: `Runtime as "107 mins", "1h47m" or "1:47"`},
+						"genres":  {Type: "array", Items: &openAPISchema{Type: "string"}, Nullable: true},
+					},
+				},
+				"MoviePatch": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"title":         {Type: "string"},
+						"year":          {Type: "integer"},
+						"runtime":       {Type: "string", Example: "1h47m", Description: `Runtime as "107 mins", "1h47m" or "1:47"`},
+						"genres":        {Type: "array", Items: &openAPISchema{Type: "string"}, Nullable: true},
+						"add_genres":    {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "Genres to add, cannot be combined with genres"},
+						"remove_genres": {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "Genres to remove, cannot be combined with genres"},
+					},
+				},
+				"Metadata": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"current_page": {Type: "integer"},
+						"page_size":    {Type: "integer"},
+						"first_page":   {Type: "integer"},
+						"last_page":    {Type: "integer"},
+						"total_record": {Type: "integer"},
+						"next_cursor":  {Type: "string"},
+					},
+				},
+				"Error": {
+					Type:       "object",
+					Properties: map[string]*openAPISchema{"error": {Type: "string"}},
+				},
+				"ValidationError": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{"error": {
+						Type:        "object",
+						Description: "Errors keyed by field, send X-Error-Format: flat for plain messages",
+						AdditionalProperties: &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{
+							"code":    {Type: "string"},
+							"message": {Type: "string"},
+						}},
+					}},
+				},
+			},
+			SecuritySchemes: map[string]map[string]interface{}{
+				"bearerAuth": {"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// openAPIHandler serves the document itself rather than an envelope, as OpenAPI tools expect
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(app.openAPISpec())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
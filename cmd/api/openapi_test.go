@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/openapi.json", ""))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	decodeJSON(t, rr, &spec)
+
+	assert.Regexp(t, `^3\.0\.`, spec.OpenAPI)
+
+	tests := []struct {
+		path    string
+		methods []string
+	}{
+		{path: "/v1/movies", methods: []string{"get", "post"}},
+		{path: "/v1/movies/{id}", methods: []string{"get", "put", "patch", "delete"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			operations, ok := spec.Paths[tt.path]
+			require.True(t, ok, "missing path %s", tt.path)
+
+			for _, method := range tt.methods {
+				assert.Contains(t, operations, method)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+var posterExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Fetch existing movie by Id
+	movie, err := app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Leave room for the multipart boundaries and headers
+	maxBytes := app.config.PosterMaxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1_048_576)
+
+	err = r.ParseMultipartForm(maxBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.payloadTooLargeResponse(w, r, maxBytes)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	file, header, err := r.FormFile("poster")
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must contain a poster file"))
+		return
+	}
+
+	defer file.Close()
+
+	if header.Size > maxBytes {
+		app.payloadTooLargeResponse(w, r, maxBytes)
+		return
+	}
+
+	// Sniff the content type rather than trusting the client
+	sniff := make([]byte, 512)
+
+	n, err := file.Read(sniff)
+	if err != nil && err != io.EOF {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(sniff[:n])
+	extension, ok := posterExtensions[contentType]
+
+	v := validator.New()
+
+	if v.Check(ok, "poster", "must be a jpeg or png image"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	posterPath := filepath.Join("posters", fmt.Sprintf("%d%s", movie.ID, extension))
+
+	err = app.savePoster(file, posterPath)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.model.Movie.SetPoster(movie.ID, posterPath)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"poster_url": app.resourceURL(fmt.Sprintf("/v1/movies/%d/poster", movie.ID))}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// posterMaxAge is how long clients and CDNs may use a poster before revalidating it, the
+// ETag changes when a new poster is uploaded
+const posterMaxAge = time.Hour
+
+// showPosterHandler serves the poster of a movie without exposing where it is stored. The
+// strong ETag is derived from the modification time and size of the file, ServeContent
+// answers If-None-Match with 304 and handles range and HEAD requests.
+func (app *application) showPosterHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if movie.PosterPath == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(app.config.UploadsDir, movie.PosterPath))
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := "application/octet-stream"
+	for mediaType, extension := range posterExtensions {
+		if filepath.Ext(movie.PosterPath) == extension {
+			contentType = mediaType
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(posterMaxAge.Seconds())))
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (app *application) savePoster(file io.Reader, posterPath string) error {
+	fullPath := filepath.Join(app.config.UploadsDir, posterPath)
+
+	err := os.MkdirAll(filepath.Dir(fullPath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	_, err = io.Copy(dst, file)
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowPoster(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.UploadsDir = t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(app.config.UploadsDir, "posters"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(app.config.UploadsDir, "posters", "1.png"), []byte("poster"), 0o644))
+
+	insertTestMovie(t, app, "Gladiator", 2000, 155, "action")
+	require.NoError(t, app.model.Movie.SetPoster(1, filepath.Join("posters", "1.png")))
+	insertTestMovie(t, app, "Heat", 1995, 170, "crime")
+
+	// The poster is public, an anonymous request gets it
+	r := newTestRequest(t, http.MethodGet, "/v1/movies/1/poster", "")
+	r.Header.Del("Authorization")
+
+	rr := serve(app, r)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "poster", rr.Body.String())
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=3600", rr.Header().Get("Cache-Control"))
+
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	r = newTestRequest(t, http.MethodGet, "/v1/movies/1/poster", "")
+	r.Header.Set("If-None-Match", etag)
+
+	rr = serve(app, r)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "no poster", target: "/v1/movies/2/poster"},
+		{name: "missing movie", target: "/v1/movies/3/poster"},
+		{name: "uploads directory", target: "/uploads/posters/1.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(app, newTestRequest(t, http.MethodGet, tt.target, ""))
+
+			assert.Equal(t, http.StatusNotFound, rr.Code, rr.Body.String())
+			assert.NotEqual(t, "poster", rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// recommendationsHandler recommends the movies co-rated highly with the movie, topped up
+// with the movies sharing its genres while there are too few ratings
+func (app *application) recommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+
+	if v.Check(limit >= 1 && limit <= 20, "limit", "must be between 1 and 20"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	_, err = app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movies, err := app.model.Rating.Recommendations(id, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	fallback := len(movies) < limit
+
+	if fallback {
+		similar, _, err := app.model.Movie.Similar(id, data.Filter{Page: 1, PageSize: limit})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		recommended := make(map[int64]bool, len(movies))
+		for _, movie := range movies {
+			recommended[movie.ID] = true
+		}
+
+		for _, movie := range similar {
+			if len(movies) == limit {
+				break
+			}
+
+			if !recommended[movie.ID] {
+				movies = append(movies, movie)
+			}
+		}
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"movies": movies, "genre_fallback": fallback}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) rateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse Id
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Rated movie must exist
+	_, err = app.model.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Score int32 `json:"score"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Update the existing rating of the user, or start a new one
+	rating, err := app.model.Rating.Get(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			rating = &data.Rating{UserID: user.ID, MovieID: id}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	rating.Score = input.Score
+
+	// Validation
+	v := validator.New()
+
+	if data.ValidateRating(v, rating); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.model.Rating.Upsert(rating)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"rating": rating}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,23 +2,138 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
-	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResonse)
+	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireActivatedUser(app.requirePermission("movies:write", app.createMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies", app.requireActivatedUser(app.requirePermission("movies:write", app.deleteMoviesBatchHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"bulk":   app.requireFeature("bulk", app.requireActivatedUser(app.requirePermission("movies:write", app.createMoviesBulkHandler))),
+		"import": app.requireFeature("import", app.requireActivatedUser(app.requirePermission("movies:write", app.importMoviesHandler))),
+	}, app.notAllowed(http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.staticOrID(map[string]http.HandlerFunc{
+		"compare":    app.compareMoviesHandler,
+		"count":      app.countMoviesHandler,
+		"export.csv": app.requireFeature("export", app.exportMoviesHandler),
+		"random":     app.randomMovieHandler,
+		"stream":     app.movieStreamHandler,
+	}, app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.requireActivatedUser(app.requirePermission("movies:write", app.replaceMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireActivatedUser(app.requirePermission("movies:write", app.patchMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireActivatedUser(app.requirePermission("movies:write", app.deleteMovieHandler)))
 
-	return app.recoverPanic(router)
+	// The poster needs no movies:read permission, so CDNs can cache it
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/:child", app.staticOrChild(map[string]http.HandlerFunc{
+		"by-slug": app.requirePermission("movies:read", app.showMovieBySlugHandler),
+	}, map[string]http.HandlerFunc{
+		"similar":         app.requirePermission("movies:read", app.similarMoviesHandler),
+		"cast":            app.requirePermission("movies:read", app.listCastHandler),
+		"history":         app.requirePermission("movies:read", app.movieHistoryHandler),
+		"reviews":         app.requirePermission("movies:read", app.listReviewsHandler),
+		"recommendations": app.requirePermission("movies:read", app.recommendationsHandler),
+		"export.json":     app.requireFeature("export", app.requirePermission("movies:read", app.exportMovieHandler)),
+		"poster":          app.showPosterHandler,
+	}))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/:child", app.requireActivatedUser(app.staticOrChild(map[string]http.HandlerFunc{
+		"external": app.requirePermission("movies:write", app.upsertMovieHandler),
+	}, map[string]http.HandlerFunc{
+		"rating":  app.rateMovieHandler,
+		"watched": app.setWatchedHandler,
+	})))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/poster", app.requireActivatedUser(app.requirePermission("movies:write", app.uploadPosterHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/cast", app.requireActivatedUser(app.requirePermission("movies:write", app.addCastMemberHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireActivatedUser(app.createReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/favorite", app.requireActivatedUser(app.addFavoriteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/favorite", app.requireActivatedUser(app.removeFavoriteHandler))
+
+	router.HandlerFunc(http.MethodPut, "/v1/reviews/:id/approved", app.requireActivatedUser(app.requirePermission("admin:write", app.approveReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id", app.requireActivatedUser(app.deleteReviewHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.requireFeature("graphql", app.requirePermission("movies:read", app.graphQLHandler())))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/stats", app.requireFeature("stats", app.requirePermission("movies:read", app.genreStatsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/genres/rename", app.requireActivatedUser(app.requirePermission("admin:write", app.renameGenreHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/years", app.requireFeature("stats", app.requirePermission("movies:read", app.yearCountsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/stats/dashboard", app.requireFeature("stats", app.requirePermission("admin:read", app.dashboardStatsHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/actors", app.requireActivatedUser(app.requirePermission("movies:write", app.createActorHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/actors/:id", app.requirePermission("movies:read", app.showActorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/actors/:id", app.requireActivatedUser(app.requirePermission("movies:write", app.updateActorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/actors/:id", app.requireActivatedUser(app.requirePermission("movies:write", app.deleteActorHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/user/movies", app.requireActivatedUser(app.listUserMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/user/watchlist", app.requireActivatedUser(app.listWatchlistHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/debug/vars", app.requirePermission("admin:read", app.debugVarsHandler))
+
+	if app.config.MetricsEnabled {
+		router.Handler(http.MethodGet, "/debug/metrics", promhttp.Handler())
+	}
+
+	return app.metrics(app.requestID(app.prettyJSON(app.compress(app.recoverPanic(app.enableCORS(app.maintenanceMode(app.rateLimit(app.authenticate(router)))))))))
+}
+
+// notAllowed answers 405 with the given Allow header, for a method only registered to
+// serve the static segments of a wildcard route
+func (app *application) notAllowed(allowed ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		app.methodNotAllowedResponse(w, r)
+	}
+}
+
+// staticOrID serves the handler of a static path segment sharing its position with
+// the :id wildcard, as httprouter does not allow both to be registered
+func (app *application) staticOrID(static map[string]http.HandlerFunc, byID http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		byID(w, r)
+	}
+}
+
+// staticOrChild serves routes such as /v1/movies/by-slug/:slug next to the /v1/movies/:id/<child>
+// routes, httprouter only allows the single :id/:child wildcard pair in that position. The
+// static handlers find their own parameter in :child.
+func (app *application) staticOrChild(static, children map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		if handler, ok := children[params.ByName("child")]; ok {
+			handler(w, r)
+			return
+		}
+
+		app.notFoundResponse(w, r)
+	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutesNotFound(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := serve(app, newTestRequest(t, http.MethodGet, "/v1/unknown", ""))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	decodeJSON(t, rr, &response)
+	assert.Equal(t, "the requested resource could not be found", response.Error)
+}
+
+func TestRoutesMethodNotAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		wantAllowed []string
+	}{
+		{name: "collection", target: "/v1/movies", wantAllowed: []string{"GET", "POST", "DELETE", "OPTIONS"}},
+		{name: "actor", target: "/v1/actors/1", wantAllowed: []string{"GET", "PATCH", "DELETE", "OPTIONS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			rr := serve(app, newTestRequest(t, http.MethodPut, tt.target, ""))
+
+			assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.ElementsMatch(t, tt.wantAllowed, strings.Split(rr.Header().Get("Allow"), ", "))
+
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, rr, &response)
+			assert.Equal(t, "the PUT method is not supported for this resource", response.Error)
+		})
+	}
+}
+
+// POST /v1/movies/:id only serves the bulk segment, other ids answer like an unregistered method
+func TestRoutesMethodNotAllowedStaticSegment(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := serve(app, newTestRequest(t, http.MethodPost, "/v1/movies/1", "{}"))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, PUT, PATCH, DELETE, OPTIONS", rr.Header().Get("Allow"))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// dashboardCache keeps the dashboard stats for ttl, a zero ttl disables caching
+type dashboardCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	stats   data.DashboardStats
+	expires time.Time
+}
+
+func (app *application) dashboardStatsHandler(w http.ResponseWriter, r *http.Request) {
+	cache := &app.dashboard
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// Holding the lock while querying lets concurrent requests wait for one query
+	if time.Now().After(cache.expires) {
+		stats, err := app.model.Movie.DashboardStats()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		cache.stats = stats
+		cache.expires = time.Now().Add(cache.ttl)
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"stats": cache.stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) yearCountsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	genres := app.readGenres(r.URL.Query(), v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	years, err := app.model.Movie.YearCounts(genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"years": years}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/data"
+)
+
+// streamKeepAlive is how often an idle stream sends a comment, so proxies do not time it out
+const streamKeepAlive = 15 * time.Second
+
+var errTooManySubscribers = errors.New("too many subscribers")
+
+// movieHub fans the movies created by this process out to the open event streams. A
+// subscriber too slow to take an event misses it instead of blocking the publisher.
+type movieHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *data.Movie]struct{}
+	closed      bool
+
+	// max bounds the concurrent subscribers, zero leaves them unbounded
+	max int
+}
+
+// subscribe returns the channel receiving the new movies, it is closed when the hub closes
+func (h *movieHub) subscribe() (chan *data.Movie, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.max > 0 && len(h.subscribers) >= h.max {
+		return nil, errTooManySubscribers
+	}
+
+	ch := make(chan *data.Movie, 16)
+
+	if h.closed {
+		close(ch)
+		return ch, nil
+	}
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan *data.Movie]struct{})
+	}
+
+	h.subscribers[ch] = struct{}{}
+
+	return ch, nil
+}
+
+func (h *movieHub) unsubscribe(ch chan *data.Movie) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (h *movieHub) publish(movie *data.Movie) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- movie:
+		default:
+		}
+	}
+}
+
+// close ends every stream, it runs when the server shuts down as the open streams
+// would otherwise keep it waiting until the shutdown timeout
+func (h *movieHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// movieStreamHandler sends a server-sent "movie" event for every movie created while the
+// stream is open. The stream ends before WRITE_TIMEOUT would cut it, EventSource clients
+// reconnect after the retry delay sent first.
+func (app *application) movieStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	movies, err := app.movieEvents.subscribe()
+	if err != nil {
+		app.tooManySubscribersResponse(w, r)
+		return
+	}
+
+	defer app.movieEvents.unsubscribe(movies)
+
+	var end <-chan time.Time
+
+	writeTimeout, err := time.ParseDuration(app.config.WriteTimeout)
+	if err == nil && writeTimeout > 0 {
+		lifetime := writeTimeout - streamKeepAlive
+		if lifetime <= 0 {
+			lifetime = writeTimeout / 2
+		}
+
+		timer := time.NewTimer(lifetime)
+		defer timer.Stop()
+
+		end = timer.C
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 2000\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case movie, ok := <-movies:
+			if !ok {
+				return
+			}
+
+			js, err := json.Marshal(movie)
+			if err != nil {
+				app.logError(r, err)
+				return
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: movie\ndata: %s\n\n", movie.ID, js)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-end:
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
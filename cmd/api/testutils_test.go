@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/stretchr/testify/require"
+)
+
+// testToken authenticates the requests of the handler tests as testUser
+const testToken = "TESTTOKENTESTTOKENTESTTOKE"
+
+var testUser = &data.User{ID: 1, Name: "Test User", Email: "test@example.com", Activated: true}
+
+// newTestApplication returns an application on top of the in-memory movie model, testUser
+// may read and write movies
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	features, err := newFeatureFlags(nil, http.StatusNotFound)
+	require.NoError(t, err)
+
+	model := data.NewMockModel()
+	model.Token = testTokenModel{}
+	model.Permission = testPermissionModel{"movies:read", "movies:write"}
+	model.Rating = testRatingModel{}
+	model.Actor = testActorModel{}
+	model.Watchlist = testWatchlistModel{}
+	model.Favorite = newTestFavoriteModel()
+
+	return &application{
+		config: Config{
+			Env:                   "testing",
+			PageSizeDefault:       20,
+			PageSizeMax:           100,
+			SearchThreshold:       0.3,
+			CorsMaxAge:            "0s",
+			FeatureDisabledStatus: http.StatusNotFound,
+		},
+		logger:   slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		model:    model,
+		features: features,
+	}
+}
+
+// newTestRequest builds a request authenticated as testUser, delete the Authorization
+// header for an anonymous one
+func newTestRequest(t *testing.T, method, target, body string) *http.Request {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+
+	return r
+}
+
+// serve sends the request through the routes and every middleware of the application
+func serve(app *application, r *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+
+	return rr
+}
+
+// decodeJSON unmarshals the body of the response into dst
+func decodeJSON(t *testing.T, rr *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), dst), rr.Body.String())
+}
+
+// fieldErrors decodes the field errors of a failed validation response into their messages
+func fieldErrors(t *testing.T, rr *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+
+	var response struct {
+		Error map[string]struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decodeJSON(t, rr, &response)
+
+	messages := make(map[string]string, len(response.Error))
+	for field, fieldError := range response.Error {
+		messages[field] = fieldError.Message
+	}
+
+	return messages
+}
+
+// insertTestMovie stores a movie in the model of the application and returns it
+func insertTestMovie(t *testing.T, app *application, title string, year int32, runtime data.Runtime, genres ...string) *data.Movie {
+	t.Helper()
+
+	movie := &data.Movie{Title: title, Year: year, Runtime: runtime, Genres: genres}
+	require.NoError(t, app.model.Movie.Insert(movie))
+
+	return movie
+}
+
+// testTokenModel knows the single token testToken, which belongs to testUser
+type testTokenModel struct{}
+
+func (testTokenModel) New(userID int64, ttl time.Duration, scope string) (*data.Token, error) {
+	return &data.Token{Plaintext: testToken, UserID: userID, Scope: scope}, nil
+}
+
+func (testTokenModel) Insert(token *data.Token) error {
+	return nil
+}
+
+func (testTokenModel) GetForToken(tokenScope, tokenPlaintext string) (*data.User, error) {
+	if tokenPlaintext != testToken {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return testUser, nil
+}
+
+func (testTokenModel) DeleteAllForUser(scope string, userID int64) error {
+	return nil
+}
+
+// testPermissionModel grants its permissions to every user
+type testPermissionModel data.Permissions
+
+func (p testPermissionModel) GetAllForUser(userID int64) (data.Permissions, error) {
+	return data.Permissions(p), nil
+}
+
+func (p testPermissionModel) AddForUser(userID int64, codes ...string) error {
+	return nil
+}
+
+// testRatingModel holds no ratings
+type testRatingModel struct{}
+
+func (testRatingModel) Get(userID, movieID int64) (*data.Rating, error) {
+	return nil, data.ErrRecordNotFound
+}
+
+func (testRatingModel) Upsert(rating *data.Rating) error {
+	rating.Version++
+	return nil
+}
+
+func (testRatingModel) AverageForMovie(movieID int64) (float64, int, error) {
+	return 0, 0, nil
+}
+
+func (testRatingModel) Recommendations(movieID int64, limit int) ([]*data.Movie, error) {
+	return []*data.Movie{}, nil
+}
+
+// testActorModel holds no actors, so every movie has an empty cast
+type testActorModel struct{}
+
+func (testActorModel) Insert(actor *data.Actor) error {
+	return nil
+}
+
+func (testActorModel) Get(id int64) (*data.Actor, error) {
+	return nil, data.ErrRecordNotFound
+}
+
+func (testActorModel) Update(actor *data.Actor) error {
+	return data.ErrRecordNotFound
+}
+
+func (testActorModel) Delete(id int64) error {
+	return data.ErrRecordNotFound
+}
+
+func (testActorModel) AddActorToMovie(movieID, actorID int64, role string) error {
+	return data.ErrRecordNotFound
+}
+
+func (testActorModel) ActorsForMovie(movieID int64, filter data.Filter) ([]*data.CastMember, data.Metadata, error) {
+	return []*data.CastMember{}, data.Metadata{}, nil
+}
+
+// testWatchlistModel holds no watched movies
+type testWatchlistModel struct{}
+
+func (testWatchlistModel) Set(userID, movieID int64, watched bool) error {
+	return nil
+}
+
+func (testWatchlistModel) IsWatched(userID, movieID int64) (bool, error) {
+	return false, nil
+}
+
+func (testWatchlistModel) ListForUser(userID int64, watched *bool) ([]*data.WatchlistEntry, error) {
+	return []*data.WatchlistEntry{}, nil
+}
+
+// testFavoriteModel keeps the favorites in memory
+type testFavoriteModel struct {
+	mu        *sync.Mutex
+	favorites map[[2]int64]bool
+}
+
+func newTestFavoriteModel() testFavoriteModel {
+	return testFavoriteModel{mu: &sync.Mutex{}, favorites: make(map[[2]int64]bool)}
+}
+
+func (m testFavoriteModel) Add(userID, movieID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.favorites[[2]int64{userID, movieID}] = true
+
+	return nil
+}
+
+func (m testFavoriteModel) Remove(userID, movieID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.favorites, [2]int64{userID, movieID})
+
+	return nil
+}
+
+func (m testFavoriteModel) IsFavorite(userID, movieID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.favorites[[2]int64{userID, movieID}], nil
+}
+
+func (m testFavoriteModel) CountForMovie(movieID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for key := range m.favorites {
+		if key[1] == movieID {
+			count++
+		}
+	}
+
+	return count, nil
+}
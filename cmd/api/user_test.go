@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterUserRejectsLongPassword(t *testing.T) {
+	app := newTestApplication(t)
+
+	body := fmt.Sprintf(`{"name":"Alice","email":"alice@example.com","password":%q}`, strings.Repeat("p", 73))
+
+	r := newTestRequest(t, http.MethodPost, "/v1/users", body)
+	r.Header.Del("Authorization")
+
+	rr := serve(app, r)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+
+	fields := fieldErrors(t, rr)
+
+	assert.Equal(t, "must not be more than 72 bytes long", fields["password"])
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/data"
+	"github.com/harryng22/moviedb/internal/validator"
+	_ "github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// movies is the development data set, a movie already stored with the same title and year is skipped
+var movies = []data.Movie{
+	{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance", "war"}},
+	{Title: "The Godfather", Year: 1972, Runtime: 175, Genres: []string{"crime", "drama"}},
+	{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+	{Title: "Back to the Future", Year: 1985, Runtime: 116, Genres: []string{"adventure", "comedy", "sci-fi"}},
+	{Title: "The Silence of the Lambs", Year: 1991, Runtime: 118, Genres: []string{"crime", "drama", "thriller"}},
+	{Title: "Pulp Fiction", Year: 1994, Runtime: 154, Genres: []string{"crime", "drama"}},
+	{Title: "Toy Story", Year: 1995, Runtime: 81, Genres: []string{"animation", "adventure", "comedy"}},
+	{Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+	{Title: "Spirited Away", Year: 2001, Runtime: 125, Genres: []string{"animation", "adventure", "fantasy"}},
+	{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation", "adventure"}},
+	{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: []string{"action", "adventure", "sci-fi"}},
+	{Title: "Parasite", Year: 2019, Runtime: 132, Genres: []string{"comedy", "drama", "thriller"}},
+}
+
+func main() {
+	configPath := flag.String("config", ".env", "path of the config file holding DB_DSN")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	db, dbTimeout, err := openDB(*configPath)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	defer db.Close()
+
+	model := data.MovieModel{DB: db, ContextTimeout: dbTimeout}
+
+	inserted, skipped := 0, 0
+
+	for i := range movies {
+		movie := movies[i]
+
+		v := validator.New()
+		if data.ValidateMovie(v, &movie); !v.Valid() {
+			fatal(logger, fmt.Errorf("invalid seed movie %q: %v", movie.Title, v.Errors))
+		}
+
+		exists, err := model.Exists(movie.Title, movie.Year)
+		if err != nil {
+			fatal(logger, err)
+		}
+
+		if exists {
+			skipped++
+			continue
+		}
+
+		err = model.Insert(&movie)
+		if err != nil {
+			fatal(logger, err, "title", movie.Title)
+		}
+
+		inserted++
+	}
+
+	fmt.Printf("inserted %d movies, skipped %d already present\n", inserted, skipped)
+}
+
+// fatal logs err at error level with the attributes in args and exits
+func fatal(logger *slog.Logger, err error, args ...any) {
+	logger.Error(err.Error(), args...)
+	os.Exit(1)
+}
+
+// openDB connects with the DB_DSN and DB_TIMEOUT of the config file the API reads
+func openDB(configPath string) (*sql.DB, time.Duration, error) {
+	viper.AddConfigPath(filepath.Dir(configPath))
+	viper.SetConfigName(filepath.Base(configPath))
+	viper.SetConfigType(strings.TrimPrefix(filepath.Ext(configPath), "."))
+
+	viper.SetDefault("DB_TIMEOUT", "3s")
+
+	viper.AutomaticEnv()
+
+	err := viper.ReadInConfig()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dbTimeout, err := time.ParseDuration(viper.GetString("DB_TIMEOUT"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	db, err := sql.Open("postgres", viper.GetString("DB_DSN"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+
+	return db, dbTimeout, nil
+}
@@ -0,0 +1,27 @@
+package data
+
+import "github.com/harryng22/moviedb/internal/validator"
+
+type Actor struct {
+	ID        int64     `json:"id"`
+	CreatedAt Timestamp `json:"created_at"`
+	Name      string    `json:"name"`
+	Version   int32     `json:"version"`
+}
+
+// CastMember is an actor playing a role in a movie
+type CastMember struct {
+	ActorID int64  `json:"actor_id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+}
+
+func ValidateActor(v *validator.Validator, actor *Actor) {
+	v.Check(actor.Name != "", "name", "must be provided")
+	v.Check(len(actor.Name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(len(role) <= 500, "role", "must not be more than 500 bytes long")
+}
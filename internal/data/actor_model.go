@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Actor Model
+type ActorModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+func (m ActorModel) Insert(actor *Actor) error {
+	query := `
+		INSERT INTO actor (name)
+		VALUES ($1)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, actor.Name).Scan(&actor.ID, &actor.CreatedAt, &actor.Version)
+}
+
+func (m ActorModel) Get(id int64) (*Actor, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, version
+		FROM actor
+		WHERE id = $1`
+
+	var actor Actor
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&actor.ID,
+		&actor.CreatedAt,
+		&actor.Name,
+		&actor.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &actor, nil
+}
+
+func (m ActorModel) Update(actor *Actor) error {
+	query := `
+		UPDATE actor
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, actor.Name, actor.ID, actor.Version).Scan(&actor.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ActorModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM actor WHERE id = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	deletedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deletedRows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m ActorModel) AddActorToMovie(movieID, actorID int64, role string) error {
+	query := `
+		INSERT INTO movie_actor (movie_id, actor_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, movieID, actorID, role)
+	return err
+}
+
+func (m ActorModel) ActorsForMovie(movieID int64, filter Filter) ([]*CastMember, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), actor.id, actor.name, movie_actor.role
+		FROM movie_actor
+		INNER JOIN actor ON actor.id = movie_actor.actor_id
+		WHERE movie_actor.movie_id = $1
+		ORDER BY actor.name ASC, movie_actor.role ASC, actor.id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filter.limit(), filter.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	cast := []*CastMember{}
+
+	for rows.Next() {
+		var member CastMember
+
+		err := rows.Scan(&totalRecords, &member.ActorID, &member.Name, &member.Role)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		cast = append(cast, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return cast, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Favorite Model
+type FavoriteModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+// Add favorites the movie for the user, a movie already favorited is left as it is
+func (m FavoriteModel) Add(userID, movieID int64) error {
+	query := `
+		INSERT INTO favorites (user_id, movie_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, movie_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	return err
+}
+
+// Remove unfavorites the movie for the user, a movie that was not favorited is not an error
+func (m FavoriteModel) Remove(userID, movieID int64) error {
+	query := `
+		DELETE FROM favorites
+		WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	return err
+}
+
+// IsFavorite reports whether the user favorited the movie
+func (m FavoriteModel) IsFavorite(userID, movieID int64) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM favorites WHERE user_id = $1 AND movie_id = $2)`
+
+	var favorite bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&favorite)
+	if err != nil {
+		return false, err
+	}
+
+	return favorite, nil
+}
+
+// CountForMovie returns how many users favorited the movie
+func (m FavoriteModel) CountForMovie(movieID int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM favorites
+		WHERE movie_id = $1`
+
+	var count int
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
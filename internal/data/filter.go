@@ -1,8 +1,13 @@
 package data
 
 import (
+	"encoding/base64"
+	"fmt"
 	"math"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/harryng22/moviedb/internal/validator"
 )
@@ -10,50 +15,281 @@ import (
 type Filter struct {
 	Page         int
 	PageSize     int
+	MaxPageSize  int
 	Sort         string
 	SortSafeList []string
+	GenresMatch  string
+	UseCursor    bool
+	Cursor       string
+	YearFrom     int
+	YearTo       int
+	RuntimeMin   int
+	RuntimeMax   int
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	// Query matches titles by trigram similarity above SimilarityThreshold, so it
+	// tolerates typos unlike the full-text title filter
+	Query               string
+	SimilarityThreshold float64
+	// Include names the counts of related records added to each listed movie
+	Include []string
+	// CreatedBy scopes the movies to those created by a user, zero lists every movie
+	CreatedBy int64
 }
 
+// IncludeCounts are the related counts a movie listing can include
+var IncludeCounts = []string{"rating_count", "cast_count"}
+
 func ValidateFilter(v *validator.Validator, f Filter) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	v.CheckCode(f.Page > 0, "page", validator.CodeOutOfRange, "must be greater than zero")
+	v.CheckCode(f.Page <= 10_000_000, "page", validator.CodeOutOfRange, "must be a maximum of 10 million")
+	v.CheckCode(f.PageSize > 0, "page_size", validator.CodeOutOfRange, "must be greater than zero")
+	v.CheckCode(f.PageSize <= f.maxPageSize(), "page_size", validator.CodeOutOfRange, fmt.Sprintf("must be a maximum of %d", f.maxPageSize()))
+
+	// Sort is a comma separated list of keys, each column may only appear once
+	sortedColumns := make(map[string]bool)
+
+	for _, key := range f.sortKeys() {
+		if !validator.In(key, f.SortSafeList...) {
+			v.AddErrorCode("sort", validator.CodeInvalid, fmt.Sprintf("invalid sort value '%s'; allowed: %s", key, f.allowedSorts()))
+			continue
+		}
+
+		column := strings.TrimPrefix(key, "-")
+		if sortedColumns[column] {
+			v.AddErrorCode("sort", validator.CodeDuplicate, "must not contain duplicate columns")
+		}
+		sortedColumns[column] = true
+	}
+
+	for _, include := range f.Include {
+		v.Check(validator.In(include, IncludeCounts...), "include", fmt.Sprintf("invalid include %q, allowed: %s", include, strings.Join(IncludeCounts, ",")))
+	}
+	v.CheckCode(validator.Unique(f.Include), "include", validator.CodeDuplicate, "must not contain duplicate values")
+
+	if f.UseCursor {
+		v.CheckCode(f.Sort == "id", "sort", validator.CodeInvalid, "must be id when paginating by cursor")
+
+		_, err := decodeCursor(f.Cursor)
+		v.CheckCode(err == nil, "cursor", validator.CodeInvalidFormat, "invalid cursor")
+	}
+
+	ValidateConditions(v, f)
+}
+
+// ValidateConditions checks the filters narrowing down the records, a zero bound is not applied
+func ValidateConditions(v *validator.Validator, f Filter) {
+	currentYear := time.Now().Year()
+
+	if f.YearFrom != 0 {
+		v.CheckCode(f.YearFrom >= 1888 && f.YearFrom <= currentYear, "year_from", validator.CodeOutOfRange, "must be between 1888 and the current year")
+	}
+
+	if f.YearTo != 0 {
+		v.CheckCode(f.YearTo >= 1888 && f.YearTo <= currentYear, "year_to", validator.CodeOutOfRange, "must be between 1888 and the current year")
+	}
+
+	if f.YearFrom != 0 && f.YearTo != 0 {
+		v.CheckCode(f.YearFrom <= f.YearTo, "year_from", validator.CodeOutOfRange, "must not be greater than year_to")
+	}
+
+	v.CheckCode(f.RuntimeMin >= 0, "runtime_min", validator.CodeOutOfRange, "must not be negative")
+	v.CheckCode(f.RuntimeMax >= 0, "runtime_max", validator.CodeOutOfRange, "must not be negative")
+
+	if f.RuntimeMin != 0 && f.RuntimeMax != 0 {
+		v.CheckCode(f.RuntimeMin <= f.RuntimeMax, "runtime_min", validator.CodeOutOfRange, "must not be greater than runtime_max")
+	}
+
+	if !f.CreatedFrom.IsZero() && !f.CreatedTo.IsZero() {
+		v.CheckCode(!f.CreatedFrom.After(f.CreatedTo), "created_from", validator.CodeOutOfRange, "must not be after created_to")
+	}
+
+	v.CheckCode(len(f.Query) <= 200, "q", validator.CodeTooLong, "must not be more than 200 bytes long")
+}
+
+// nullTime turns an unset time bound into a NULL argument
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// encodeCursor turns the last seen id into an opaque cursor
+func encodeCursor(id int64) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the last seen id of a cursor, an empty cursor starts from the beginning
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(decoded), 10, 64)
+}
+
+func (f Filter) sortKeys() []string {
+	return strings.Split(f.Sort, ",")
+}
+
+// allowedSorts describes the safe list for error messages, columns that can be sorted both
+// ways are listed once
+func (f Filter) allowedSorts() string {
+	ascending := []string{}
+	bothWays := true
+
+	for _, key := range f.SortSafeList {
+		if strings.HasPrefix(key, "-") {
+			continue
+		}
+
+		ascending = append(ascending, key)
+		bothWays = bothWays && validator.In("-"+key, f.SortSafeList...)
+	}
+
+	if !bothWays || len(ascending)*2 != len(f.SortSafeList) {
+		return strings.Join(f.SortSafeList, ",")
+	}
+
+	return strings.Join(ascending, ",") + " and their descending forms"
 }
 
-func (f Filter) sortColumn() string {
+func (f Filter) sortColumn(key string) string {
 	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+		if key == safeValue {
+			return strings.TrimPrefix(key, "-")
 		}
 	}
 
-	panic("unsafe sort parameter: " + f.Sort)
+	panic("unsafe sort parameter: " + key)
 }
 
-func (f Filter) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+func sortDirection(key string) string {
+	if strings.HasPrefix(key, "-") {
 		return "DESC"
 	}
 
 	return "ASC"
 }
 
+// orderBy builds the ORDER BY clause from the sort keys with id as the final tiebreaker,
+// expressions replaces sort columns that are not plain table columns
+func (f Filter) orderBy(expressions map[string]string) string {
+	clauses := []string{}
+
+	for _, key := range f.sortKeys() {
+		column := f.sortColumn(key)
+		if expression, ok := expressions[column]; ok {
+			column = expression
+		}
+
+		clauses = append(clauses, column+" "+sortDirection(key))
+	}
+
+	clauses = append(clauses, "id ASC")
+
+	return strings.Join(clauses, ", ")
+}
+
+// genresOperator returns the array operator used to match genres,
+// containment for "all" and overlap for "any"
+func (f Filter) genresOperator() string {
+	if f.GenresMatch == "any" {
+		return "&&"
+	}
+
+	return "@>"
+}
+
+// DefaultMaxPageSize caps the page size when the filter does not set its own maximum
+const DefaultMaxPageSize = 100
+
+func (f Filter) maxPageSize() int {
+	if f.MaxPageSize > 0 {
+		return f.MaxPageSize
+	}
+
+	return DefaultMaxPageSize
+}
+
 func (f Filter) limit() int {
 	return f.PageSize
 }
 
 func (f Filter) offset() int {
+	if f.UseCursor {
+		return 0
+	}
+
 	return (f.Page - 1) * f.PageSize
 }
 
+func (f Filter) afterID() int64 {
+	if !f.UseCursor {
+		return 0
+	}
+
+	id, _ := decodeCursor(f.Cursor)
+	return id
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_record,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty" xml:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty" xml:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty" xml:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty" xml:"last_page,omitempty"`
+	TotalRecords int    `json:"total_record,omitempty" xml:"total_record,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+	Links        *Links `json:"links,omitempty" xml:"links,omitempty"`
+}
+
+// Links are absolute page URLs, Prev and Next are nil on the first and last page
+type Links struct {
+	First string  `json:"first" xml:"first"`
+	Prev  *string `json:"prev" xml:"prev"`
+	Next  *string `json:"next" xml:"next"`
+	Last  string  `json:"last" xml:"last"`
+}
+
+// SetLinks builds the page links from the URL of the current page, keeping its other query parameters
+func (m *Metadata) SetLinks(current url.URL) {
+	if m.CurrentPage == 0 {
+		return
+	}
+
+	pageURL := func(page int) string {
+		query := current.Query()
+		query.Set("page", strconv.Itoa(page))
+
+		u := current
+		u.RawQuery = query.Encode()
+
+		return u.String()
+	}
+
+	links := &Links{
+		First: pageURL(m.FirstPage),
+		Last:  pageURL(m.LastPage),
+	}
+
+	if m.CurrentPage > m.FirstPage {
+		prev := pageURL(m.CurrentPage - 1)
+		links.Prev = &prev
+	}
+
+	if m.CurrentPage < m.LastPage {
+		next := pageURL(m.CurrentPage + 1)
+		links.Next = &next
+	}
+
+	m.Links = links
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -69,3 +305,15 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// calculateCursorMetadata reports the cursor of the next page, remainingRecords counts every
+// record after the current cursor including the ones of this page
+func calculateCursorMetadata(remainingRecords, pageSize int, lastID int64) Metadata {
+	metadata := Metadata{PageSize: pageSize}
+
+	if remainingRecords > pageSize {
+		metadata.NextCursor = encodeCursor(lastID)
+	}
+
+	return metadata
+}
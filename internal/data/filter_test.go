@@ -0,0 +1,61 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/harryng22/moviedb/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConditionsRuntime(t *testing.T) {
+	tests := []struct {
+		name       string
+		min, max   int
+		wantErrors map[string]string
+	}{
+		{name: "unset", wantErrors: map[string]string{}},
+		{name: "range", min: 100, max: 120, wantErrors: map[string]string{}},
+		{name: "negative min", min: -1, wantErrors: map[string]string{"runtime_min": "must not be negative"}},
+		{name: "negative max", max: -1, wantErrors: map[string]string{"runtime_max": "must not be negative"}},
+		{name: "min above max", min: 120, max: 100, wantErrors: map[string]string{"runtime_min": "must not be greater than runtime_max"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateConditions(v, Filter{RuntimeMin: tt.min, RuntimeMax: tt.max})
+
+			assert.Equal(t, tt.wantErrors, v.Errors)
+		})
+	}
+}
+
+func TestValidateFilterSort(t *testing.T) {
+	bothWays := []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	tests := []struct {
+		name     string
+		sort     string
+		safeList []string
+		wantErr  string
+	}{
+		{name: "allowed", sort: "-year,title", safeList: bothWays},
+		{name: "unknown column", sort: "foo", safeList: bothWays, wantErr: "invalid sort value 'foo'; allowed: id,title,year,runtime and their descending forms"},
+		{name: "unknown among allowed", sort: "title,-foo", safeList: bothWays, wantErr: "invalid sort value '-foo'; allowed: id,title,year,runtime and their descending forms"},
+		{name: "one way only", sort: "title", safeList: []string{"id", "-id", "-similarity"}, wantErr: "invalid sort value 'title'; allowed: id,-id,-similarity"},
+		{name: "duplicate column", sort: "year,-year", safeList: bothWays, wantErr: "must not contain duplicate columns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := testFilter()
+			filter.Sort = tt.sort
+			filter.SortSafeList = tt.safeList
+
+			v := validator.New()
+			ValidateFilter(v, filter)
+
+			assert.Equal(t, tt.wantErr, v.Errors["sort"])
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Genre Model
+type GenreModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+// Exists reports whether every name is one of the canonical genres
+func (m GenreModel) Exists(names []string) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (
+			SELECT 1
+			FROM unnest($1::text[]) AS submitted(name)
+			WHERE submitted.name NOT IN (SELECT name FROM genres)
+		)`
+
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, pq.Array(names)).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (m GenreModel) GetAll() ([]string, error) {
+	query := `
+		SELECT name
+		FROM genres
+		ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genres := []string{}
+
+	for rows.Next() {
+		var name string
+
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
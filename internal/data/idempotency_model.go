@@ -0,0 +1,92 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Idempotency Model
+type IdempotencyModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+// InsertMovie inserts the movie once per idempotency key of the user. A repeated key with
+// the same request hash sets the movie as it was returned by the original request and
+// reports it as replayed. Requests sharing a key are serialized by an advisory lock on the key.
+func (m IdempotencyModel) InsertMovie(userID int64, key string, requestHash []byte, ttl time.Duration, movie *Movie) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1::text || ':' || $2))`, userID, key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expiry < NOW()`, userID, key)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		SELECT request_hash, response
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	var (
+		storedHash []byte
+		response   []byte
+	)
+
+	err = tx.QueryRowContext(ctx, query, userID, key).Scan(&storedHash, &response)
+
+	switch {
+	case err == nil:
+		if !bytes.Equal(storedHash, requestHash) {
+			return false, ErrIdempotencyKeyReused
+		}
+
+		err = json.Unmarshal(response, movie)
+		if err != nil {
+			return false, err
+		}
+
+		movie.CreatedBy = userID
+
+		return true, tx.Commit()
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, err
+	}
+
+	err = insertMovie(ctx, tx, movie)
+	if err != nil {
+		return false, err
+	}
+
+	response, err = json.Marshal(movie)
+	if err != nil {
+		return false, err
+	}
+
+	query = `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, movie_id, response, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.ExecContext(ctx, query, userID, key, requestHash, movie.ID, response, time.Now().Add(ttl))
+	if err != nil {
+		return false, err
+	}
+
+	return false, tx.Commit()
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyModelInsertMovie(t *testing.T) {
+	m := NewModel(newTestDB(t), 3*time.Second, 10*time.Second, 3, nil, 0)
+
+	alice := insertTestUser(t, m, "alice@example.com")
+	bob := insertTestUser(t, m, "bob@example.com")
+
+	newMovie := func(userID int64) *Movie {
+		return &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}, CreatedBy: userID}
+	}
+
+	original := newMovie(alice.ID)
+	replayed, err := m.Idempotency.InsertMovie(alice.ID, "key", []byte("hash"), time.Hour, original)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	// The same key of another user is a request of its own
+	other := newMovie(bob.ID)
+	other.Year = 2001
+	replayed, err = m.Idempotency.InsertMovie(bob.ID, "key", []byte("other hash"), time.Hour, other)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.NotEqual(t, original.ID, other.ID)
+
+	// The replay returns the movie as it was created, not as it is now
+	updated, err := m.Movie.Get(original.ID)
+	require.NoError(t, err)
+	updated.Title = "Gladiator (Extended)"
+	require.NoError(t, m.Movie.Update(updated))
+
+	replay := newMovie(alice.ID)
+	replayed, err = m.Idempotency.InsertMovie(alice.ID, "key", []byte("hash"), time.Hour, replay)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, original.ID, replay.ID)
+	assert.Equal(t, "Gladiator", replay.Title)
+	assert.Equal(t, original.Version, replay.Version)
+
+	_, err = m.Idempotency.InsertMovie(alice.ID, "key", []byte("different hash"), time.Hour, newMovie(alice.ID))
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
@@ -0,0 +1,661 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockMovieModel is an in-memory movie store for handler tests that run without a database
+type MockMovieModel struct {
+	mu      *sync.Mutex
+	nextID  *int64
+	movies  map[int64]Movie
+	history map[int64][]MovieVersion
+}
+
+func NewMockMovieModel() MockMovieModel {
+	var nextID int64 = 1
+
+	return MockMovieModel{
+		mu:      &sync.Mutex{},
+		nextID:  &nextID,
+		movies:  make(map[int64]Movie),
+		history: make(map[int64][]MovieVersion),
+	}
+}
+
+func NewMockModel() Model {
+	return Model{
+		Movie: NewMockMovieModel(),
+	}
+}
+
+func (m MockMovieModel) Insert(movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if movie.ExternalID != "" {
+		for _, stored := range m.movies {
+			if stored.ExternalID == movie.ExternalID {
+				return ErrDuplicateExternalID
+			}
+		}
+	}
+
+	m.insert(movie)
+
+	return nil
+}
+
+func (m MockMovieModel) insert(movie *Movie) {
+	movie.ID = *m.nextID
+	movie.CreatedAt = Timestamp{time.Now()}
+	movie.Version = 1
+	movie.Slug = Slugify(movie.Title, movie.Year)
+
+	*m.nextID++
+	m.movies[movie.ID] = copyMovie(movie)
+}
+
+func (m MockMovieModel) InsertBatch(movies []*Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, movie := range movies {
+		m.insert(movie)
+	}
+
+	return nil
+}
+
+// Import keeps the movies read before an error, the mock has no transaction to roll back
+func (m MockMovieModel) Import(ctx context.Context, next func() (*Movie, error), rejected func(movie *Movie, err error)) (int, error) {
+	imported := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		movie, err := next()
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		err = m.Insert(movie)
+		if err != nil {
+			rejected(movie, err)
+			continue
+		}
+
+		imported++
+	}
+}
+
+func (m MockMovieModel) Get(id int64) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	stored := copyMovie(&movie)
+	return &stored, nil
+}
+
+func (m MockMovieModel) GetByExternalID(externalID string) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, movie := range m.movies {
+		if movie.ExternalID == externalID {
+			stored := copyMovie(&movie)
+			return &stored, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMovieModel) GetMany(ids []int64) ([]*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movies := []*Movie{}
+
+	for _, id := range ids {
+		if movie, ok := m.movies[id]; ok {
+			stored := copyMovie(&movie)
+			movies = append(movies, &stored)
+		}
+	}
+
+	return movies, nil
+}
+
+// GetBySlug ignores collision suffixes, the mock never adds them
+func (m MockMovieModel) GetBySlug(slug string) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, movie := range m.movies {
+		if movie.Slug == slug {
+			stored := copyMovie(&movie)
+			return &stored, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMovieModel) Update(movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.ID]
+	if !ok || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	if base := Slugify(movie.Title, movie.Year); !hasSlugBase(movie.Slug, base) {
+		movie.Slug = base
+	}
+
+	m.record(stored, "update")
+
+	movie.Version++
+	m.movies[movie.ID] = copyMovie(movie)
+
+	return nil
+}
+
+// UpdateLocked holds the lock of the whole store while fn runs
+func (m MockMovieModel) UpdateLocked(id int64, fn func(movie *Movie) error) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	movie := copyMovie(&stored)
+
+	err := fn(&movie)
+	if err != nil {
+		return nil, err
+	}
+
+	if movie.Version != stored.Version {
+		return nil, ErrEditConflict
+	}
+
+	if base := Slugify(movie.Title, movie.Year); !hasSlugBase(movie.Slug, base) {
+		movie.Slug = base
+	}
+
+	m.record(stored, "update")
+
+	movie.Version++
+	m.movies[id] = copyMovie(&movie)
+
+	return &movie, nil
+}
+
+func (m MockMovieModel) Upsert(movie *Movie) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, stored := range m.movies {
+		if stored.ExternalID != movie.ExternalID {
+			continue
+		}
+
+		movie.ID = id
+		movie.CreatedAt = stored.CreatedAt
+		movie.Slug = stored.Slug
+		movie.Version = stored.Version + 1
+
+		if base := Slugify(movie.Title, movie.Year); !hasSlugBase(movie.Slug, base) {
+			movie.Slug = base
+		}
+
+		m.record(stored, "update")
+
+		m.movies[id] = copyMovie(movie)
+		return false, nil
+	}
+
+	m.insert(movie)
+
+	return true, nil
+}
+
+func (m MockMovieModel) Delete(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	m.record(stored, "delete")
+	delete(m.movies, id)
+
+	return nil
+}
+
+func (m MockMovieModel) DeleteVersioned(id, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	if int64(movie.Version) != version {
+		return ErrEditConflict
+	}
+
+	m.record(movie, "delete")
+	delete(m.movies, id)
+
+	return nil
+}
+
+func (m MockMovieModel) DeleteBatch(ids []int64) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := []int64{}
+
+	for _, id := range ids {
+		if stored, ok := m.movies[id]; ok {
+			m.record(stored, "delete")
+			delete(m.movies, id)
+			deleted = append(deleted, id)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m MockMovieModel) SetPoster(id int64, posterPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	movie.PosterPath = posterPath
+	m.movies[id] = movie
+
+	return nil
+}
+
+// GetAll matches titles by substring and genres by containment, ordered by id
+func (m MockMovieModel) GetAll(title string, genres []string, filter Filter) ([]*Movie, Metadata, error) {
+	matched := m.matching(title, genres)
+
+	totalRecords := len(matched)
+
+	start := filter.offset()
+	if start > len(matched) {
+		start = len(matched)
+	}
+
+	end := start + filter.limit()
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+func (m MockMovieModel) GetAllForUser(userID int64, title string, genres []string, filter Filter) ([]*Movie, Metadata, error) {
+	matched := []*Movie{}
+
+	for _, movie := range m.matching(title, genres) {
+		if movie.CreatedBy == userID {
+			matched = append(matched, movie)
+		}
+	}
+
+	totalRecords := len(matched)
+
+	start := filter.offset()
+	if start > len(matched) {
+		start = len(matched)
+	}
+
+	end := start + filter.limit()
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+func (m MockMovieModel) Count(title string, genres []string, filter Filter) (int, error) {
+	return len(m.matching(title, genres)), nil
+}
+
+func (m MockMovieModel) GetRandom(genres []string) (*Movie, error) {
+	matched := m.matching("", genres)
+	if len(matched) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return matched[rand.Intn(len(matched))], nil
+}
+
+func (m MockMovieModel) Similar(movieID int64, filter Filter) ([]*Movie, Metadata, error) {
+	source, err := m.Get(movieID)
+	if err != nil {
+		return []*Movie{}, Metadata{}, nil
+	}
+
+	overlaps := make(map[int64]int)
+	movies := []*Movie{}
+
+	for _, movie := range m.matching("", nil) {
+		overlap := 0
+		for _, genre := range movie.Genres {
+			if containsAll(source.Genres, []string{genre}) {
+				overlap++
+			}
+		}
+
+		if movie.ID != movieID && overlap > 0 {
+			overlaps[movie.ID] = overlap
+			movies = append(movies, movie)
+		}
+	}
+
+	sort.SliceStable(movies, func(i, j int) bool {
+		return overlaps[movies[i].ID] > overlaps[movies[j].ID]
+	})
+
+	totalRecords := len(movies)
+
+	start := filter.offset()
+	if start > len(movies) {
+		start = len(movies)
+	}
+
+	end := start + filter.limit()
+	if end > len(movies) {
+		end = len(movies)
+	}
+
+	return movies[start:end], calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+func (m MockMovieModel) History(id int64) ([]MovieVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions, ok := m.history[id]
+	if !ok {
+		if _, exists := m.movies[id]; !exists {
+			return nil, ErrRecordNotFound
+		}
+	}
+
+	return append([]MovieVersion{}, versions...), nil
+}
+
+// record keeps the stored movie as a version before it is changed or deleted, unlike the
+// history trigger it does not skip updates leaving the fields as they were. The caller
+// must hold the lock.
+func (m MockMovieModel) record(stored Movie, operation string) {
+	m.history[stored.ID] = append(m.history[stored.ID], MovieVersion{
+		Version:   stored.Version,
+		Title:     stored.Title,
+		Year:      stored.Year,
+		Runtime:   stored.Runtime,
+		Genres:    append([]string(nil), stored.Genres...),
+		Operation: operation,
+		ChangedAt: Timestamp{time.Now()},
+	})
+}
+
+// UpdateGenres merges the genres under the lock of the whole store, like the single
+// statement of MovieModel
+func (m MockMovieModel) UpdateGenres(id int64, version int32, add, remove []string, check func(movie *Movie) error) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	if version != 0 && version != stored.Version {
+		return nil, ErrEditConflict
+	}
+
+	movie := copyMovie(&stored)
+	movie.Genres = MergeGenres(movie.Genres, add, remove)
+	movie.Version++
+
+	err := check(&movie)
+	if err != nil {
+		return nil, err
+	}
+
+	m.record(stored, "update")
+	m.movies[id] = copyMovie(&movie)
+
+	return &movie, nil
+}
+
+func (m MockMovieModel) RenameGenre(from, to string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	updated := 0
+
+	for id, movie := range m.movies {
+		if !containsAll(movie.Genres, []string{from}) {
+			continue
+		}
+
+		m.record(movie, "update")
+
+		hasTo := containsAll(movie.Genres, []string{to})
+		genres := []string{}
+
+		for _, genre := range movie.Genres {
+			switch {
+			case genre != from:
+				genres = append(genres, genre)
+			case !hasTo:
+				genres = append(genres, to)
+			}
+		}
+
+		movie.Genres = genres
+		movie.Version++
+		m.movies[id] = movie
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+func (m MockMovieModel) GenreCounts(minCount int) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	for _, movie := range m.matching("", nil) {
+		for _, genre := range movie.Genres {
+			counts[genre]++
+		}
+	}
+
+	for genre, count := range counts {
+		if count < minCount {
+			delete(counts, genre)
+		}
+	}
+
+	return counts, nil
+}
+
+func (m MockMovieModel) DashboardStats() (DashboardStats, error) {
+	stats := DashboardStats{Decades: []DecadeCount{}, TopGenres: []GenreCount{}}
+
+	movies := m.matching("", nil)
+	if len(movies) == 0 {
+		return stats, nil
+	}
+
+	stats.TotalMovies = len(movies)
+	stats.MinYear, stats.MaxYear = movies[0].Year, movies[0].Year
+
+	runtime := 0
+	decades := make(map[int32]int)
+	genres := make(map[string]int)
+
+	for _, movie := range movies {
+		runtime += int(movie.Runtime)
+		decades[movie.Year/10*10]++
+
+		if movie.Year < stats.MinYear {
+			stats.MinYear = movie.Year
+		}
+		if movie.Year > stats.MaxYear {
+			stats.MaxYear = movie.Year
+		}
+
+		for _, genre := range movie.Genres {
+			genres[genre]++
+		}
+	}
+
+	stats.AverageRuntime = math.Round(float64(runtime)/float64(len(movies))*10) / 10
+
+	for decade, count := range decades {
+		stats.Decades = append(stats.Decades, DecadeCount{Decade: decade, Count: count})
+	}
+	sort.Slice(stats.Decades, func(i, j int) bool { return stats.Decades[i].Decade < stats.Decades[j].Decade })
+
+	for genre, count := range genres {
+		stats.TopGenres = append(stats.TopGenres, GenreCount{Genre: genre, Count: count})
+	}
+	sort.Slice(stats.TopGenres, func(i, j int) bool {
+		if stats.TopGenres[i].Count != stats.TopGenres[j].Count {
+			return stats.TopGenres[i].Count > stats.TopGenres[j].Count
+		}
+		return stats.TopGenres[i].Genre < stats.TopGenres[j].Genre
+	})
+
+	if len(stats.TopGenres) > 5 {
+		stats.TopGenres = stats.TopGenres[:5]
+	}
+
+	return stats, nil
+}
+
+func (m MockMovieModel) YearCounts(genres []string) ([]YearCount, error) {
+	counts := make(map[int32]int)
+
+	for _, movie := range m.matching("", genres) {
+		counts[movie.Year]++
+	}
+
+	years := []YearCount{}
+	for year, count := range counts {
+		years = append(years, YearCount{Year: year, Count: count})
+	}
+
+	sort.Slice(years, func(i, j int) bool { return years[i].Year > years[j].Year })
+
+	return years, nil
+}
+
+func (m MockMovieModel) Stream(ctx context.Context, title string, genres []string, filter Filter, fn func(movie *Movie) error) error {
+	for _, movie := range m.matching(title, genres) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(movie); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m MockMovieModel) matching(title string, genres []string) []*Movie {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movies := []*Movie{}
+
+	for _, movie := range m.movies {
+		if !strings.Contains(strings.ToLower(movie.Title), strings.ToLower(title)) {
+			continue
+		}
+
+		if !containsAll(movie.Genres, genres) {
+			continue
+		}
+
+		stored := copyMovie(&movie)
+		movies = append(movies, &stored)
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		return movies[i].ID < movies[j].ID
+	})
+
+	return movies
+}
+
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+
+		for _, value := range values {
+			if value == w {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyMovie keeps the stored genres from being shared with callers
+func copyMovie(movie *Movie) Movie {
+	stored := *movie
+	if movie.Genres != nil {
+		stored.Genres = append([]string{}, movie.Genres...)
+	}
+
+	return stored
+}
@@ -0,0 +1,403 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMockModel returns a mock holding Gladiator (1), The Matrix (2) and Heat (3)
+func newTestMockModel(t *testing.T) MockMovieModel {
+	t.Helper()
+
+	m := NewMockMovieModel()
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action", "drama"}},
+		&Movie{Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+		&Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+	)
+
+	return m
+}
+
+func TestMockMovieModelInsert(t *testing.T) {
+	m := NewMockMovieModel()
+
+	first := &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}, ExternalID: "tt0172495"}
+	second := &Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}}
+
+	require.NoError(t, m.Insert(first))
+	require.NoError(t, m.Insert(second))
+
+	assert.Equal(t, int64(1), first.ID)
+	assert.Equal(t, int64(2), second.ID)
+	assert.Equal(t, int32(1), first.Version)
+	assert.Equal(t, "gladiator-2000", first.Slug)
+	assert.False(t, first.CreatedAt.IsZero())
+
+	err := m.Insert(&Movie{Title: "Gladiator II", Year: 2024, ExternalID: "tt0172495"})
+	assert.ErrorIs(t, err, ErrDuplicateExternalID)
+}
+
+func TestMockMovieModelInsertBatch(t *testing.T) {
+	m := NewMockMovieModel()
+
+	movies := []*Movie{{Title: "Gladiator", Year: 2000}, {Title: "Heat", Year: 1995}}
+	require.NoError(t, m.InsertBatch(movies))
+
+	assert.Equal(t, int64(1), movies[0].ID)
+	assert.Equal(t, int64(2), movies[1].ID)
+}
+
+func TestMockMovieModelImport(t *testing.T) {
+	m := NewMockMovieModel()
+	require.NoError(t, m.Insert(&Movie{Title: "Gladiator", Year: 2000, ExternalID: "tt0172495"}))
+
+	movies := []*Movie{
+		{Title: "Heat", Year: 1995},
+		{Title: "Gladiator", Year: 2000, ExternalID: "tt0172495"},
+	}
+
+	var rejected []*Movie
+
+	imported, err := m.Import(context.Background(), func() (*Movie, error) {
+		if len(movies) == 0 {
+			return nil, io.EOF
+		}
+
+		movie := movies[0]
+		movies = movies[1:]
+
+		return movie, nil
+	}, func(movie *Movie, err error) {
+		assert.ErrorIs(t, err, ErrDuplicateExternalID)
+		rejected = append(rejected, movie)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, imported)
+	assert.Len(t, rejected, 1)
+
+	_, err = m.Import(context.Background(), func() (*Movie, error) { return nil, errors.New("bad row") }, nil)
+	assert.EqualError(t, err, "bad row")
+}
+
+func TestMockMovieModelGet(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.Get(2)
+	require.NoError(t, err)
+	assert.Equal(t, "The Matrix", movie.Title)
+
+	// The returned movie does not share its genres with the store
+	movie.Genres[0] = "changed"
+
+	stored, err := m.Get(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"action", "sci-fi"}, stored.Genres)
+
+	_, err = m.Get(42)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelGetByExternalID(t *testing.T) {
+	m := NewMockMovieModel()
+	require.NoError(t, m.Insert(&Movie{Title: "Gladiator", Year: 2000, ExternalID: "tt0172495"}))
+
+	movie, err := m.GetByExternalID("tt0172495")
+	require.NoError(t, err)
+	assert.Equal(t, "Gladiator", movie.Title)
+
+	_, err = m.GetByExternalID("tt0000000")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelGetMany(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movies, err := m.GetMany([]int64{3, 42, 1})
+	require.NoError(t, err)
+
+	require.Len(t, movies, 2)
+	assert.Equal(t, "Heat", movies[0].Title)
+	assert.Equal(t, "Gladiator", movies[1].Title)
+}
+
+func TestMockMovieModelGetBySlug(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.GetBySlug("the-matrix-1999")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), movie.ID)
+
+	_, err = m.GetBySlug("unknown-2000")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelUpdate(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.Get(1)
+	require.NoError(t, err)
+
+	stale := *movie
+
+	movie.Title = "Gladiator II"
+	movie.Year = 2024
+	require.NoError(t, m.Update(movie))
+
+	assert.Equal(t, int32(2), movie.Version)
+	assert.Equal(t, "gladiator-ii-2024", movie.Slug)
+
+	stale.Title = "Gladiator (Extended)"
+	assert.ErrorIs(t, m.Update(&stale), ErrEditConflict)
+
+	assert.ErrorIs(t, m.Update(&Movie{ID: 42, Version: 1}), ErrEditConflict)
+}
+
+func TestMockMovieModelUpdateLocked(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.UpdateLocked(1, func(movie *Movie) error {
+		movie.Runtime = 171
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Runtime(171), movie.Runtime)
+	assert.Equal(t, int32(2), movie.Version)
+
+	errInvalid := errors.New("invalid")
+
+	_, err = m.UpdateLocked(1, func(movie *Movie) error { return errInvalid })
+	assert.ErrorIs(t, err, errInvalid)
+
+	_, err = m.UpdateLocked(42, func(movie *Movie) error { return nil })
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelUpdateGenres(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.UpdateGenres(1, 1, []string{"history"}, []string{"action"}, func(movie *Movie) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"drama", "history"}, movie.Genres)
+
+	_, err = m.UpdateGenres(1, 1, []string{"war"}, nil, func(movie *Movie) error { return nil })
+	assert.ErrorIs(t, err, ErrEditConflict)
+
+	_, err = m.UpdateGenres(42, 0, []string{"war"}, nil, func(movie *Movie) error { return nil })
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelUpsert(t *testing.T) {
+	m := NewMockMovieModel()
+
+	movie := &Movie{Title: "Gladiator", Year: 2000, ExternalID: "tt0172495"}
+
+	created, err := m.Upsert(movie)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	replacement := &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, ExternalID: "tt0172495"}
+
+	created, err = m.Upsert(replacement)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, movie.ID, replacement.ID)
+	assert.Equal(t, int32(2), replacement.Version)
+}
+
+func TestMockMovieModelDelete(t *testing.T) {
+	m := newTestMockModel(t)
+
+	require.NoError(t, m.Delete(1))
+
+	_, err := m.Get(1)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	assert.ErrorIs(t, m.Delete(1), ErrRecordNotFound)
+}
+
+func TestMockMovieModelDeleteVersioned(t *testing.T) {
+	m := newTestMockModel(t)
+
+	assert.ErrorIs(t, m.DeleteVersioned(1, 2), ErrEditConflict)
+	assert.NoError(t, m.DeleteVersioned(1, 1))
+	assert.ErrorIs(t, m.DeleteVersioned(1, 1), ErrRecordNotFound)
+}
+
+func TestMockMovieModelDeleteBatch(t *testing.T) {
+	m := newTestMockModel(t)
+
+	deleted, err := m.DeleteBatch([]int64{1, 3, 42})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, deleted)
+
+	count, err := m.Count("", nil, Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestMockMovieModelSetPoster(t *testing.T) {
+	m := newTestMockModel(t)
+
+	require.NoError(t, m.SetPoster(1, "posters/1.jpg"))
+
+	movie, err := m.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "posters/1.jpg", movie.PosterPath)
+
+	assert.ErrorIs(t, m.SetPoster(42, "posters/42.jpg"), ErrRecordNotFound)
+}
+
+func TestMockMovieModelGetAll(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movies, metadata, err := m.GetAll("", []string{"drama"}, Filter{Page: 1, PageSize: 1})
+	require.NoError(t, err)
+
+	require.Len(t, movies, 1)
+	assert.Equal(t, "Gladiator", movies[0].Title)
+	assert.Equal(t, 2, metadata.TotalRecords)
+	assert.Equal(t, 2, metadata.LastPage)
+
+	movies, _, err = m.GetAll("matrix", []string{}, Filter{Page: 1, PageSize: 20})
+	require.NoError(t, err)
+
+	require.Len(t, movies, 1)
+	assert.Equal(t, "The Matrix", movies[0].Title)
+}
+
+func TestMockMovieModelGetAllForUser(t *testing.T) {
+	m := NewMockMovieModel()
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, CreatedBy: 7},
+		&Movie{Title: "Heat", Year: 1995},
+	)
+
+	movies, metadata, err := m.GetAllForUser(7, "", []string{}, Filter{Page: 1, PageSize: 20})
+	require.NoError(t, err)
+
+	require.Len(t, movies, 1)
+	assert.Equal(t, "Gladiator", movies[0].Title)
+	assert.Equal(t, 1, metadata.TotalRecords)
+}
+
+func TestMockMovieModelGetRandom(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.GetRandom([]string{"sci-fi"})
+	require.NoError(t, err)
+	assert.Equal(t, "The Matrix", movie.Title)
+
+	_, err = m.GetRandom([]string{"western"})
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelSimilar(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movies, metadata, err := m.Similar(1, Filter{Page: 1, PageSize: 20})
+	require.NoError(t, err)
+
+	assert.Len(t, movies, 2)
+	assert.Equal(t, 2, metadata.TotalRecords)
+}
+
+func TestMockMovieModelHistory(t *testing.T) {
+	m := newTestMockModel(t)
+
+	movie, err := m.Get(1)
+	require.NoError(t, err)
+
+	movie.Runtime = 171
+	require.NoError(t, m.Update(movie))
+
+	versions, err := m.History(1)
+	require.NoError(t, err)
+
+	require.Len(t, versions, 1)
+	assert.Equal(t, int32(1), versions[0].Version)
+	assert.Equal(t, Runtime(155), versions[0].Runtime)
+	assert.Equal(t, "update", versions[0].Operation)
+
+	_, err = m.History(42)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMockMovieModelRenameGenre(t *testing.T) {
+	m := newTestMockModel(t)
+
+	updated, err := m.RenameGenre("drama", "crime")
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	gladiator, err := m.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"action", "crime"}, gladiator.Genres)
+
+	// Heat already had crime and keeps it once
+	heat, err := m.Get(3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crime"}, heat.Genres)
+}
+
+func TestMockMovieModelGenreCounts(t *testing.T) {
+	m := newTestMockModel(t)
+
+	counts, err := m.GenreCounts(2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"action": 2, "drama": 2}, counts)
+}
+
+func TestMockMovieModelDashboardStats(t *testing.T) {
+	m := newTestMockModel(t)
+
+	stats, err := m.DashboardStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, stats.TotalMovies)
+	assert.Equal(t, 153.7, stats.AverageRuntime)
+	assert.Equal(t, int32(1995), stats.MinYear)
+	assert.Equal(t, int32(2000), stats.MaxYear)
+	assert.Equal(t, []DecadeCount{{Decade: 1990, Count: 2}, {Decade: 2000, Count: 1}}, stats.Decades)
+	assert.Equal(t, GenreCount{Genre: "action", Count: 2}, stats.TopGenres[0])
+}
+
+func TestMockMovieModelYearCounts(t *testing.T) {
+	m := newTestMockModel(t)
+
+	years, err := m.YearCounts([]string{"drama"})
+	require.NoError(t, err)
+	assert.Equal(t, []YearCount{{Year: 2000, Count: 1}, {Year: 1995, Count: 1}}, years)
+}
+
+func TestMockMovieModelStream(t *testing.T) {
+	m := newTestMockModel(t)
+
+	var titles []string
+
+	err := m.Stream(context.Background(), "", []string{"action"}, Filter{}, func(movie *Movie) error {
+		titles = append(titles, movie.Title)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Gladiator", "The Matrix"}, titles)
+
+	errStop := errors.New("stop")
+
+	err = m.Stream(context.Background(), "", nil, Filter{}, func(movie *Movie) error { return errStop })
+	assert.ErrorIs(t, err, errStop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = m.Stream(ctx, "", nil, Filter{}, func(movie *Movie) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
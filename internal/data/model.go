@@ -1,27 +1,147 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 )
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordNotFound      = errors.New("record not found")
+	ErrEditConflict        = errors.New("edit conflict")
+	ErrDuplicateEmail      = errors.New("duplicate email")
+	ErrDuplicateMovie      = errors.New("duplicate movie")
+	ErrDuplicateExternalID = errors.New("duplicate external id")
+
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
 )
 
+// BatchError reports which record of a batch operation failed
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("record %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
 type Model struct {
 	Movie interface {
 		Insert(movie *Movie) error
+		InsertBatch(movies []*Movie) error
+		Import(ctx context.Context, next func() (*Movie, error), rejected func(movie *Movie, err error)) (int, error)
 		Get(id int64) (*Movie, error)
+		GetBySlug(slug string) (*Movie, error)
+		GetByExternalID(externalID string) (*Movie, error)
+		GetMany(ids []int64) ([]*Movie, error)
+		GetRandom(genres []string) (*Movie, error)
+		Similar(movieID int64, filter Filter) ([]*Movie, Metadata, error)
+		GenreCounts(minCount int) (map[string]int, error)
+		RenameGenre(from, to string) (int, error)
+		History(id int64) ([]MovieVersion, error)
+		DashboardStats() (DashboardStats, error)
+		YearCounts(genres []string) ([]YearCount, error)
 		Update(movie *Movie) error
+		UpdateLocked(id int64, fn func(movie *Movie) error) (*Movie, error)
+		UpdateGenres(id int64, version int32, add, remove []string, check func(movie *Movie) error) (*Movie, error)
+		Upsert(movie *Movie) (created bool, err error)
 		Delete(id int64) error
+		DeleteVersioned(id, version int64) error
+		DeleteBatch(ids []int64) ([]int64, error)
 		GetAll(title string, genres []string, filter Filter) ([]*Movie, Metadata, error)
+		GetAllForUser(userID int64, title string, genres []string, filter Filter) ([]*Movie, Metadata, error)
+		Count(title string, genres []string, filter Filter) (int, error)
+		Stream(ctx context.Context, title string, genres []string, filter Filter, fn func(movie *Movie) error) error
+		SetPoster(id int64, posterPath string) error
+	}
+	User interface {
+		Insert(user *User) error
+		Register(user *User, codes []string, activationTTL time.Duration) (*Token, error)
+		GetByEmail(email string) (*User, error)
+		Update(user *User) error
+	}
+	Token interface {
+		New(userID int64, ttl time.Duration, scope string) (*Token, error)
+		Insert(token *Token) error
+		GetForToken(tokenScope, tokenPlaintext string) (*User, error)
+		DeleteAllForUser(scope string, userID int64) error
+	}
+	Rating interface {
+		Get(userID, movieID int64) (*Rating, error)
+		Upsert(rating *Rating) error
+		AverageForMovie(movieID int64) (float64, int, error)
+		Recommendations(movieID int64, limit int) ([]*Movie, error)
+	}
+	Review interface {
+		Insert(review *Review) error
+		Get(id int64) (*Review, error)
+		ListForMovie(movieID int64, includeUnapproved bool, filter Filter) ([]*Review, Metadata, error)
+		Approve(review *Review) error
+		Delete(id int64) error
+	}
+	Actor interface {
+		Insert(actor *Actor) error
+		Get(id int64) (*Actor, error)
+		Update(actor *Actor) error
+		Delete(id int64) error
+		AddActorToMovie(movieID, actorID int64, role string) error
+		ActorsForMovie(movieID int64, filter Filter) ([]*CastMember, Metadata, error)
+	}
+	Genre interface {
+		Exists(names []string) (bool, error)
+		GetAll() ([]string, error)
+	}
+	Permission interface {
+		GetAllForUser(userID int64) (Permissions, error)
+		AddForUser(userID int64, codes ...string) error
+	}
+	Watchlist interface {
+		Set(userID, movieID int64, watched bool) error
+		IsWatched(userID, movieID int64) (bool, error)
+		ListForUser(userID int64, watched *bool) ([]*WatchlistEntry, error)
+	}
+	Favorite interface {
+		Add(userID, movieID int64) error
+		Remove(userID, movieID int64) error
+		IsFavorite(userID, movieID int64) (bool, error)
+		CountForMovie(movieID int64) (int, error)
+	}
+	Idempotency interface {
+		InsertMovie(userID int64, key string, requestHash []byte, ttl time.Duration, movie *Movie) (bool, error)
 	}
 }
 
-func NewModel(db *sql.DB) Model {
+// NewModel builds every model on top of db, each query is bounded by timeout and the
+// writes of many movies at once by batchTimeout. Movie queries are retried up to retries
+// times on transient errors, and logged to logger when they take slowQueryThreshold or more.
+func NewModel(db *sql.DB, timeout, batchTimeout time.Duration, retries int, logger *slog.Logger, slowQueryThreshold time.Duration) Model {
 	return Model{
-		Movie: MovieModel{DB: db},
+		Movie: MovieModel{
+			DB:                 db,
+			ContextTimeout:     timeout,
+			BatchTimeout:       batchTimeout,
+			Retries:            retries,
+			Logger:             logger,
+			SlowQueryThreshold: slowQueryThreshold,
+		},
+		User:   UserModel{DB: db, ContextTimeout: timeout},
+		Token:  TokenModel{DB: db, ContextTimeout: timeout},
+		Rating: RatingModel{DB: db, ContextTimeout: timeout},
+		Review: ReviewModel{DB: db, ContextTimeout: timeout},
+		Actor:  ActorModel{DB: db, ContextTimeout: timeout},
+		Genre:  GenreModel{DB: db, ContextTimeout: timeout},
+
+		Permission:  PermissionModel{DB: db, ContextTimeout: timeout},
+		Idempotency: IdempotencyModel{DB: db, ContextTimeout: timeout},
+		Watchlist:   WatchlistModel{DB: db, ContextTimeout: timeout},
+		Favorite:    FavoriteModel{DB: db, ContextTimeout: timeout},
 	}
-}
\ No newline at end of file
+}
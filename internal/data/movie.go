@@ -1,36 +1,159 @@
 package data
 
 import (
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/harryng22/moviedb/internal/validator"
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"create_at"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID         int64     `json:"id" xml:"id"`
+	CreatedAt  Timestamp `json:"create_at" xml:"create_at"`
+	Title      string    `json:"title" xml:"title"`
+	Slug       string    `json:"slug,omitempty" xml:"slug,omitempty"`
+	Year       int32     `json:"year,omitempty" xml:"year,omitempty"`
+	Runtime    Runtime   `json:"runtime,omitempty" xml:"runtime,omitempty"`
+	Genres     []string  `json:"genres" xml:"genres>genre,omitempty"`
+	Version    int32     `json:"version" xml:"version"`
+	PosterPath string    `json:"-" xml:"-"`
+	ExternalID string    `json:"external_id,omitempty" xml:"external_id,omitempty"`
+
+	// CreatedBy is the id of the user who created the movie, zero when unknown
+	CreatedBy int64 `json:"-" xml:"-"`
+
+	// RatingCount and CastCount are only set when listed with include
+	RatingCount *int `json:"rating_count,omitempty" xml:"rating_count,omitempty"`
+	CastCount   *int `json:"cast_count,omitempty" xml:"cast_count,omitempty"`
+
+	// RuntimeFormat set to RuntimeFormatISO8601 marshals the runtime to JSON as an ISO 8601 duration
+	RuntimeFormat string `json:"-" xml:"-"`
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+// MovieVersion is a movie as it was before an update or a delete, Operation is either
+// "update" or "delete"
+type MovieVersion struct {
+	Version   int32     `json:"version" xml:"version"`
+	Title     string    `json:"title" xml:"title"`
+	Year      int32     `json:"year" xml:"year"`
+	Runtime   Runtime   `json:"runtime" xml:"runtime"`
+	Genres    []string  `json:"genres" xml:"genres>genre"`
+	Operation string    `json:"operation" xml:"operation"`
+	ChangedAt Timestamp `json:"changed_at" xml:"changed_at"`
+}
+
+const (
+	RuntimeFormatMins    = "mins"
+	RuntimeFormatISO8601 = "iso8601"
+)
+
+// MarshalJSON leaves out a zero year and runtime while they are still being entered,
+// genres are always an array so clients never see null
+func (m Movie) MarshalJSON() ([]byte, error) {
+	// movieJSON has the fields and tags of Movie without this method
+	type movieJSON Movie
+
+	movie := movieJSON(m)
+	if movie.Genres == nil {
+		movie.Genres = []string{}
+	}
+
+	if m.RuntimeFormat == RuntimeFormatISO8601 {
+		// The outer runtime field shadows the one of movieJSON
+		iso := struct {
+			movieJSON
+			Runtime string `json:"runtime,omitempty"`
+		}{movieJSON: movie}
+
+		if m.Runtime != 0 {
+			iso.Runtime = m.Runtime.ISO8601()
+		}
+
+		return json.Marshal(iso)
+	}
+
+	return json.Marshal(movie)
+}
+
+// ExternalIDRX matches the id of a movie in an external catalogue, optionally prefixed
+// with its source such as "tmdb:603"
+var ExternalIDRX = regexp.MustCompile("^[a-z0-9]+(:[A-Za-z0-9_-]+)?$")
+
+func ValidateExternalID(v *validator.Validator, externalID string) {
+	v.CheckCode(externalID != "", "external_id", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(externalID) <= 100, "external_id", validator.CodeTooLong, "must not be more than 100 bytes long")
+	v.CheckCode(validator.Matches(externalID, ExternalIDRX), "external_id", validator.CodeInvalidFormat, "must be an id such as 603 or tmdb:603")
+}
+
+func ValidateGenreRename(v *validator.Validator, from, to string) {
+	v.CheckCode(from != "", "from", validator.CodeRequired, "must be provided")
+	v.CheckCode(to != "", "to", validator.CodeRequired, "must be provided")
+	v.CheckCode(from != to, "to", validator.CodeInvalid, "must be different from from")
+}
+
+// ValidateGenreChanges checks the genres a patch adds and removes, a genre cannot be in both
+func ValidateGenreChanges(v *validator.Validator, add, remove []string) {
+	v.CheckCode(len(add) <= 5, "add_genres", validator.CodeTooLong, "must not contain more than 5 genres")
+	v.CheckCode(validator.Unique(add), "add_genres", validator.CodeDuplicate, "must not contain duplicate values")
+	v.CheckCode(validator.NoBlanks(add), "add_genres", validator.CodeRequired, "must not contain blank values")
+
+	v.CheckCode(validator.Unique(remove), "remove_genres", validator.CodeDuplicate, "must not contain duplicate values")
+	v.CheckCode(validator.NoBlanks(remove), "remove_genres", validator.CodeRequired, "must not contain blank values")
+
+	for _, genre := range add {
+		if validator.In(genre, remove...) {
+			v.AddErrorCode("remove_genres", validator.CodeInvalid, fmt.Sprintf("must not contain %q which is also added", genre))
+			break
+		}
+	}
+}
+
+// MergeGenres removes and then adds genres, keeping the order of the genres already set
+// and appending the added ones that are missing
+func MergeGenres(genres, add, remove []string) []string {
+	merged := []string{}
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	for _, genre := range genres {
+		if !validator.In(genre, remove...) && !validator.In(genre, merged...) {
+			merged = append(merged, genre)
+		}
+	}
 
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
+	for _, genre := range add {
+		if !validator.In(genre, merged...) {
+			merged = append(merged, genre)
+		}
+	}
 
-	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genres")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	return merged
 }
 
+// MovieFields lists the JSON keys of a Movie that can be selected in listings
+var MovieFields = []string{"id", "create_at", "title", "year", "runtime", "genres", "version", "rating_count", "cast_count"}
 
+func ValidateMovie(v *validator.Validator, movie *Movie) {
+	ValidatePatchedMovie(v, movie)
+
+	v.CheckCode(len(movie.Genres) >= 1, "genres", validator.CodeTooShort, "must contain at least 1 genres")
+}
+
+// ValidatePatchedMovie checks a movie after a partial update, which may clear its genres
+// with an explicit null or by removing every one of them
+func ValidatePatchedMovie(v *validator.Validator, movie *Movie) {
+	v.CheckCode(movie.Title != "", "title", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(movie.Title) <= 500, "title", validator.CodeTooLong, "must not be more than 500 bytes long")
+
+	v.CheckCode(movie.Year != 0, "year", validator.CodeRequired, "must be provided")
+	v.CheckCode(movie.Year >= 1888, "year", validator.CodeOutOfRange, "must be greater than 1888")
+	v.CheckCode(movie.Year <= int32(time.Now().Year()), "year", validator.CodeOutOfRange, "must not be in the future")
+
+	v.CheckCode(movie.Runtime != 0, "runtime", validator.CodeRequired, "must be provided")
+	v.CheckCode(movie.Runtime > 0, "runtime", validator.CodeOutOfRange, "must be a positive integer")
+
+	v.CheckCode(movie.Genres != nil, "genres", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(movie.Genres) <= 5, "genres", validator.CodeTooLong, "must not contain more than 5 genres")
+	v.CheckCode(validator.Unique(movie.Genres), "genres", validator.CodeDuplicate, "must not contain duplicate values")
+	v.CheckCode(validator.NoBlanks(movie.Genres), "genres", validator.CodeRequired, "must not contain blank values")
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// CachedMovieModel keeps the most recently read movies in memory in front of
+// MovieModel.Get. Every write path invalidates the entries it touches.
+type CachedMovieModel struct {
+	MovieModel
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[int64]*list.Element
+
+	// generation is bumped on every invalidation so a read that raced a write
+	// does not put the row it fetched before the write back into the cache
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cacheEntry struct {
+	id    int64
+	movie Movie
+}
+
+func NewCachedMovieModel(model MovieModel, size int) *CachedMovieModel {
+	return &CachedMovieModel{
+		MovieModel: model,
+		size:       size,
+		order:      list.New(),
+		entries:    make(map[int64]*list.Element),
+	}
+}
+
+// Hits returns how many Get calls were served from the cache
+func (m *CachedMovieModel) Hits() int64 {
+	return m.hits.Load()
+}
+
+// Misses returns how many Get calls went to the database
+func (m *CachedMovieModel) Misses() int64 {
+	return m.misses.Load()
+}
+
+func (m *CachedMovieModel) Get(id int64) (*Movie, error) {
+	m.mu.Lock()
+
+	if element, ok := m.entries[id]; ok {
+		m.order.MoveToFront(element)
+		movie := copyMovie(&element.Value.(*cacheEntry).movie)
+		m.mu.Unlock()
+
+		m.hits.Add(1)
+		return &movie, nil
+	}
+
+	generation := m.generation
+	m.mu.Unlock()
+
+	m.misses.Add(1)
+
+	movie, err := m.MovieModel.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if generation == m.generation {
+		m.add(movie)
+	}
+
+	return movie, nil
+}
+
+func (m *CachedMovieModel) Update(movie *Movie) error {
+	defer m.invalidate(movie.ID)
+
+	return m.MovieModel.Update(movie)
+}
+
+func (m *CachedMovieModel) UpdateLocked(id int64, fn func(movie *Movie) error) (*Movie, error) {
+	defer m.invalidate(id)
+
+	return m.MovieModel.UpdateLocked(id, fn)
+}
+
+func (m *CachedMovieModel) UpdateGenres(id int64, version int32, add, remove []string, check func(movie *Movie) error) (*Movie, error) {
+	defer m.invalidate(id)
+
+	return m.MovieModel.UpdateGenres(id, version, add, remove, check)
+}
+
+func (m *CachedMovieModel) Upsert(movie *Movie) (bool, error) {
+	created, err := m.MovieModel.Upsert(movie)
+	if err == nil && !created {
+		m.invalidate(movie.ID)
+	}
+
+	return created, err
+}
+
+func (m *CachedMovieModel) Delete(id int64) error {
+	defer m.invalidate(id)
+
+	return m.MovieModel.Delete(id)
+}
+
+func (m *CachedMovieModel) DeleteVersioned(id, version int64) error {
+	defer m.invalidate(id)
+
+	return m.MovieModel.DeleteVersioned(id, version)
+}
+
+func (m *CachedMovieModel) DeleteBatch(ids []int64) ([]int64, error) {
+	defer m.invalidate(ids...)
+
+	return m.MovieModel.DeleteBatch(ids)
+}
+
+func (m *CachedMovieModel) SetPoster(id int64, posterPath string) error {
+	defer m.invalidate(id)
+
+	return m.MovieModel.SetPoster(id, posterPath)
+}
+
+// RenameGenre may change any movie, so the whole cache is dropped
+func (m *CachedMovieModel) RenameGenre(from, to string) (int, error) {
+	defer m.invalidateAll()
+
+	return m.MovieModel.RenameGenre(from, to)
+}
+
+// add stores a copy of movie, evicting the least recently used entry when full.
+// The caller must hold the lock.
+func (m *CachedMovieModel) add(movie *Movie) {
+	if m.size < 1 {
+		return
+	}
+
+	if element, ok := m.entries[movie.ID]; ok {
+		element.Value.(*cacheEntry).movie = copyMovie(movie)
+		m.order.MoveToFront(element)
+		return
+	}
+
+	m.entries[movie.ID] = m.order.PushFront(&cacheEntry{id: movie.ID, movie: copyMovie(movie)})
+
+	if m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+func (m *CachedMovieModel) invalidate(ids ...int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+
+	for _, id := range ids {
+		if element, ok := m.entries[id]; ok {
+			m.order.Remove(element)
+			delete(m.entries, id)
+		}
+	}
+}
+
+func (m *CachedMovieModel) invalidateAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+
+	m.order.Init()
+	m.entries = make(map[int64]*list.Element)
+}
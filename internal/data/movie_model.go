@@ -3,56 +3,228 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
-// Movie Model
+// Movie Model, reads and idempotent writes are retried up to Retries times on transient errors.
+// Writes spanning many movies are bounded by BatchTimeout instead of ContextTimeout, a zero
+// BatchTimeout falls back to ContextTimeout. Queries slower than SlowQueryThreshold are logged
+// as warnings when Logger is set, every query is logged at debug level.
 type MovieModel struct {
-	DB *sql.DB
+	DB                 *sql.DB
+	ContextTimeout     time.Duration
+	BatchTimeout       time.Duration
+	Retries            int
+	Logger             *slog.Logger
+	SlowQueryThreshold time.Duration
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertMovie picks the slug again when a concurrent insert took it first, the conflict
+// on the slug alone is skipped so that it does not abort the transaction q may be in
+func insertMovie(ctx context.Context, q queryRower, movie *Movie) error {
 	query := `
-		INSERT INTO movie (title, year, runtime, genres)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO movie (title, year, runtime, genres, slug, external_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0))
+		ON CONFLICT (slug) DO NOTHING
 		RETURNING id, created_at, version`
 
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	base := Slugify(movie.Title, movie.Year)
+
+	for attempt := 1; ; attempt++ {
+		slug, err := uniqueSlug(ctx, q, base, 0)
+		if err != nil {
+			return err
+		}
+
+		args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), slug, movie.ExternalID, movie.CreatedBy}
+
+		err = q.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows) && attempt < slugAttempts:
+				continue
+			case errors.Is(err, sql.ErrNoRows):
+				return fmt.Errorf("no free slug for %q after %d attempts", base, attempt)
+			case isDuplicateMovie(err):
+				return ErrDuplicateMovie
+			case isDuplicateExternalID(err):
+				return ErrDuplicateExternalID
+			default:
+				return err
+			}
+		}
+
+		movie.Slug = slug
+
+		return nil
+	}
+}
+
+// isDuplicateMovie reports whether err violates the unique title and year constraint
+func isDuplicateMovie(err error) bool {
+	var pqErr *pq.Error
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "movie_title_year_key"
+}
+
+// isDuplicateExternalID reports whether err violates the unique external id constraint
+func isDuplicateExternalID(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "movie_external_id_key"
+}
+
+// isDuplicateSlug reports whether err violates the unique slug index, another movie took
+// the slug between uniqueSlug and the write
+func isDuplicateSlug(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "movie_slug_idx"
+}
+
+func (m MovieModel) Insert(movie *Movie) error {
+	defer m.logSlowQuery("Insert", map[string]string{"title": movie.Title, "year": strconv.Itoa(int(movie.Year))})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	return insertMovie(ctx, m.DB, movie)
+}
+
+// InsertBatch inserts all movies in a single transaction, either every movie is inserted or none
+func (m MovieModel) InsertBatch(movies []*Movie) error {
+	defer m.logSlowQuery("InsertBatch", map[string]string{"movies": strconv.Itoa(len(movies))})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.batchTimeout())
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for i, movie := range movies {
+		err = insertMovie(ctx, tx, movie)
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Import inserts the movies returned by next until it returns io.EOF, all in a single
+// transaction. A movie violating a unique constraint is passed to rejected and skipped,
+// any other error rolls the whole import back. Each insert gets its own timeout, the
+// import as a whole lasts as long as next takes to read the movies, so it is not logged
+// as a slow query either. Cancelling ctx rolls the transaction back and frees its
+// connection, even while next is still waiting on a slow reader.
+func (m MovieModel) Import(ctx context.Context, next func() (*Movie, error), rejected func(movie *Movie, err error)) (int, error) {
+	imported := 0
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	// The savepoint keeps the transaction usable after a rejected insert
+	exec := func(query string) error {
+		ctx, cancel := context.WithTimeout(ctx, m.ContextTimeout)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+
+	for {
+		movie, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if err = exec("SAVEPOINT import_movie"); err != nil {
+			return 0, err
+		}
+
+		insertCtx, cancel := context.WithTimeout(ctx, m.ContextTimeout)
+		err = insertMovie(insertCtx, tx, movie)
+		cancel()
+
+		switch {
+		case errors.Is(err, ErrDuplicateMovie), errors.Is(err, ErrDuplicateExternalID):
+			if err := exec("ROLLBACK TO SAVEPOINT import_movie"); err != nil {
+				return 0, err
+			}
+
+			rejected(movie, err)
+		case err != nil:
+			return 0, err
+		default:
+			imported++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return imported, nil
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	defer m.logSlowQuery("Get", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
 		FROM movie
 		WHERE id = $1`
 
 	var movie Movie
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, id).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Slug,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.PosterPath,
+			&movie.ExternalID,
+		)
+	})
 
 	if err != nil {
 		switch {
@@ -66,112 +238,1222 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filter Filter) ([]*Movie, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+// GetMany returns the movies with the given ids in the order of ids, ids without a movie
+// are left out
+func (m MovieModel) GetMany(ids []int64) ([]*Movie, error) {
+	defer m.logSlowQuery("GetMany", map[string]string{"ids": strconv.Itoa(len(ids))})()
+
+	query := `
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
 		FROM movie
-		WHERE ($1 = '' OR to_tsvector('simple', title) @@ plainto_tsquery('simple', $1))
-		AND (genres @> $2 OR $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filter.sortColumn(), filter.sortDirection())
+		WHERE id = ANY($1)
+		ORDER BY array_position($1, id)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, title, pq.Array(genres), filter.limit(), filter.offset())
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, err
 	}
 
 	defer rows.Close()
 
-	totalRecords := 0
 	movies := []*Movie{}
 
 	for rows.Next() {
 		var movie Movie
 
 		err := rows.Scan(
-			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
+			&movie.Slug,
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.PosterPath,
+			&movie.ExternalID,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, err
 		}
 
 		movies = append(movies, &movie)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filter.Page, filter.PageSize)
-
-	return movies, metadata, nil
+	return movies, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) GetBySlug(slug string) (*Movie, error) {
+	defer m.logSlowQuery("GetBySlug", map[string]string{"slug": slug})()
+
 	query := `
-		UPDATE movie
-		set title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 and version = $6
-		RETURNING version`
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
+		FROM movie
+		WHERE slug = $1`
 
-	args := []interface{}{
-		movie.Title,
-		movie.Year,
-		movie.Runtime,
-		pq.Array(movie.Genres),
-		movie.ID,
-		movie.Version,
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, slug).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Slug,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.PosterPath,
+			&movie.ExternalID,
+		)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return &movie, nil
+}
+
+func (m MovieModel) GetByExternalID(externalID string) (*Movie, error) {
+	defer m.logSlowQuery("GetByExternalID", map[string]string{"external_id": externalID})()
+
+	query := `
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
+		FROM movie
+		WHERE external_id = $1`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, externalID).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Slug,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.PosterPath,
+			&movie.ExternalID,
+		)
+	})
+
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
+			return nil, ErrRecordNotFound
 		default:
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return &movie, nil
 }
 
-func (m MovieModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
+// movieConditions builds the WHERE clause shared by the movie listing queries,
+// the title is always the first argument
+func movieConditions(title string, genres []string, filter Filter) (string, []interface{}) {
+	where := fmt.Sprintf(`
+		WHERE ($1 = '' OR to_tsvector('simple', title) @@ plainto_tsquery('simple', $1))
+		AND (genres %s $2 OR $2 = '{}')
+		AND ($3 = 0 OR year >= $3)
+		AND ($4 = 0 OR year <= $4)
+		AND ($5 = 0 OR runtime >= $5)
+		AND ($6 = 0 OR runtime <= $6)
+		AND ($7::timestamptz IS NULL OR created_at >= $7)
+		AND ($8::timestamptz IS NULL OR created_at <= $8)
+		AND ($9 = '' OR similarity(title, $9) > $10)
+		AND ($11 = 0 OR created_by = $11)`, filter.genresOperator())
+
+	args := []interface{}{
+		title,
+		pq.Array(genres),
+		filter.YearFrom,
+		filter.YearTo,
+		filter.RuntimeMin,
+		filter.RuntimeMax,
+		nullTime(filter.CreatedFrom),
+		nullTime(filter.CreatedTo),
+		filter.Query,
+		filter.SimilarityThreshold,
+		filter.CreatedBy,
 	}
 
-	query := `DELETE FROM movie WHERE id = $1;`
+	return where, args
+}
+
+// Count returns the number of movies matching the filters, pagination and sorting are ignored
+func (m MovieModel) Count(title string, genres []string, filter Filter) (int, error) {
+	defer m.logSlowQuery("Count", conditionProperties(title, genres, filter))()
+
+	where, args := movieConditions(title, genres, filter)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	query := fmt.Sprintf(`
+		SELECT count(*)
+		FROM movie
+		%s`, where)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	var count int
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&count)
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	deletedRows, err := result.RowsAffected()
+	return count, nil
+}
+
+// Exists reports whether a movie with exactly this title and year is stored
+func (m MovieModel) Exists(title string, year int32) (bool, error) {
+	defer m.logSlowQuery("Exists", map[string]string{"title": title, "year": strconv.Itoa(int(year))})()
+
+	query := `
+		SELECT EXISTS(SELECT 1 FROM movie WHERE title = $1 AND year = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	var exists bool
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, title, year).Scan(&exists)
+	})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if deletedRows == 0 {
-		return ErrRecordNotFound
+	return exists, nil
+}
+
+// GetAllForUser is GetAll scoped to the movies created by the user
+func (m MovieModel) GetAllForUser(userID int64, title string, genres []string, filter Filter) ([]*Movie, Metadata, error) {
+	filter.CreatedBy = userID
+
+	return m.GetAll(title, genres, filter)
+}
+
+func (m MovieModel) GetAll(title string, genres []string, filter Filter) ([]*Movie, Metadata, error) {
+	defer m.logSlowQuery("GetAll", conditionProperties(title, genres, filter))()
+
+	// Sorting by rank orders by relevance of the title to the full-text search,
+	// similarity by closeness of the title to the fuzzy search
+	orderBy := filter.orderBy(map[string]string{
+		"rank":       "ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1))",
+		"similarity": "similarity(title, $9)",
+	})
+
+	where, args := movieConditions(title, genres, filter)
+
+	// The counts are aggregated once per table and joined, rather than queried per movie
+	counts, joins := "", ""
+
+	for _, include := range filter.Include {
+		switch include {
+		case "rating_count":
+			counts += ", COALESCE(rc.rating_count, 0)"
+			joins += `
+		LEFT JOIN (SELECT movie_id, count(*) AS rating_count FROM ratings GROUP BY movie_id) rc ON rc.movie_id = movie.id`
+		case "cast_count":
+			counts += ", COALESCE(cc.cast_count, 0)"
+			joins += `
+		LEFT JOIN (SELECT movie_id, count(*) AS cast_count FROM movie_actor GROUP BY movie_id) cc ON cc.movie_id = movie.id`
+		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	n := len(args)
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version%s
+		FROM movie%s
+		%s
+		AND id > $%d
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, counts, joins, where, n+1, orderBy, n+2, n+3)
+
+	args = append(args, filter.afterID(), filter.limit(), filter.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		dest := []interface{}{
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		}
+
+		for _, include := range filter.Include {
+			count := new(int)
+
+			switch include {
+			case "rating_count":
+				movie.RatingCount = count
+			case "cast_count":
+				movie.CastCount = count
+			}
+
+			dest = append(dest, count)
+		}
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filter.UseCursor {
+		var lastID int64
+		if len(movies) > 0 {
+			lastID = movies[len(movies)-1].ID
+		}
+
+		return movies, calculateCursorMetadata(totalRecords, filter.PageSize, lastID), nil
+	}
+
+	metadata := calculateMetadata(totalRecords, filter.Page, filter.PageSize)
+
+	return movies, metadata, nil
+}
+
+// GetRandom returns one random movie having all of the given genres
+func (m MovieModel) GetRandom(genres []string) (*Movie, error) {
+	defer m.logSlowQuery("GetRandom", map[string]string{"genres": strings.Join(genres, ",")})()
+
+	where, args := movieConditions("", genres, Filter{})
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
+		FROM movie
+		%s
+		ORDER BY random()
+		LIMIT 1`, where)
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Slug,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.PosterPath,
+			&movie.ExternalID,
+		)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// Similar returns the movies sharing at least one genre with the given movie, those
+// with the most genres in common first
+func (m MovieModel) Similar(movieID int64, filter Filter) ([]*Movie, Metadata, error) {
+	defer m.logSlowQuery("Similar", map[string]string{"movie_id": strconv.FormatInt(movieID, 10), "page": strconv.Itoa(filter.Page), "page_size": strconv.Itoa(filter.PageSize)})()
+
+	query := `
+		SELECT count(*) OVER(), m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version
+		FROM movie m
+		JOIN movie source ON source.id = $1
+		WHERE m.id <> source.id AND m.genres && source.genres
+		ORDER BY cardinality(ARRAY(SELECT unnest(m.genres) INTERSECT SELECT unnest(source.genres))) DESC, m.id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filter.limit(), filter.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return movies, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+// YearCounts returns the number of movies per release year, latest year first. With
+// genres only movies having all of them are counted.
+func (m MovieModel) YearCounts(genres []string) ([]YearCount, error) {
+	defer m.logSlowQuery("YearCounts", map[string]string{"genres": strings.Join(genres, ",")})()
+
+	query := `
+		SELECT year, count(*)
+		FROM movie
+		WHERE genres @> $1 OR $1 = '{}'
+		GROUP BY year
+		ORDER BY year DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(genres))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := []YearCount{}
+
+	for rows.Next() {
+		var count YearCount
+
+		err := rows.Scan(&count.Year, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// DashboardStats gathers the dashboard numbers in a single round trip, the per decade
+// counts and the 5 most common genres are aggregated to JSON by Postgres
+func (m MovieModel) DashboardStats() (DashboardStats, error) {
+	defer m.logSlowQuery("DashboardStats", nil)()
+
+	query := `
+		SELECT
+			(SELECT count(*) FROM movie),
+			(SELECT COALESCE(round(avg(runtime), 1), 0)::float8 FROM movie),
+			(SELECT COALESCE(min(year), 0) FROM movie),
+			(SELECT COALESCE(max(year), 0) FROM movie),
+			(SELECT COALESCE(json_agg(json_build_object('decade', decade, 'count', n) ORDER BY decade), '[]')
+				FROM (SELECT year / 10 * 10 AS decade, count(*) AS n FROM movie GROUP BY 1) decades),
+			(SELECT COALESCE(json_agg(json_build_object('genre', genre, 'count', n) ORDER BY n DESC, genre), '[]')
+				FROM (SELECT genre, count(*) AS n FROM movie, unnest(genres) AS genre GROUP BY genre ORDER BY n DESC, genre LIMIT 5) genres)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	var (
+		stats              DashboardStats
+		decades, topGenres []byte
+	)
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query).Scan(
+			&stats.TotalMovies,
+			&stats.AverageRuntime,
+			&stats.MinYear,
+			&stats.MaxYear,
+			&decades,
+			&topGenres,
+		)
+	})
+	if err != nil {
+		return DashboardStats{}, err
+	}
+
+	err = json.Unmarshal(decades, &stats.Decades)
+	if err != nil {
+		return DashboardStats{}, err
+	}
+
+	err = json.Unmarshal(topGenres, &stats.TopGenres)
+	if err != nil {
+		return DashboardStats{}, err
+	}
+
+	return stats, nil
+}
+
+// History returns the earlier versions of a movie, oldest first. A deleted movie keeps
+// its history, ErrRecordNotFound means the movie never existed.
+func (m MovieModel) History(id int64) ([]MovieVersion, error) {
+	defer m.logSlowQuery("History", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
+	query := `
+		SELECT version, title, year, runtime, genres, operation, changed_at
+		FROM movie_history
+		WHERE movie_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := []MovieVersion{}
+
+	for rows.Next() {
+		var version MovieVersion
+
+		err := rows.Scan(
+			&version.Version,
+			&version.Title,
+			&version.Year,
+			&version.Runtime,
+			pq.Array(&version.Genres),
+			&version.Operation,
+			&version.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A movie that was never changed has no history but still exists
+	if len(versions) == 0 {
+		var exists bool
+
+		err = m.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM movie WHERE id = $1)`, id).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, ErrRecordNotFound
+		}
+	}
+
+	return versions, nil
+}
+
+// RenameGenre replaces the genre from by to in every movie and in the canonical genres,
+// returning how many movies changed. A movie already having both keeps to only once.
+func (m MovieModel) RenameGenre(from, to string) (int, error) {
+	defer m.logSlowQuery("RenameGenre", map[string]string{"from": from, "to": to})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.batchTimeout())
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		UPDATE movie
+		SET genres = CASE WHEN $2 = ANY(genres) THEN array_remove(genres, $1) ELSE array_replace(genres, $1, $2) END,
+			version = version + 1
+		WHERE $1 = ANY(genres)`
+
+	result, err := tx.ExecContext(ctx, query, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO genres (name) VALUES ($1) ON CONFLICT DO NOTHING`, to)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genres WHERE name = $1`, from)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(updated), nil
+}
+
+// GenreCounts returns how many movies have each genre, genres on fewer than minCount movies are left out
+func (m MovieModel) GenreCounts(minCount int) (map[string]int, error) {
+	defer m.logSlowQuery("GenreCounts", map[string]string{"min_count": strconv.Itoa(minCount)})()
+
+	query := `
+		SELECT genre, count(*)
+		FROM movie, unnest(genres) AS genre
+		GROUP BY genre
+		HAVING count(*) >= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, minCount)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[string]int)
+
+	for rows.Next() {
+		var (
+			genre string
+			count int
+		)
+
+		if err := rows.Scan(&genre, &count); err != nil {
+			return nil, err
+		}
+
+		counts[genre] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// Stream passes every movie matching the filters to fn as it is scanned, ordered by id,
+// so callers can write out the whole catalog without holding it in memory. The cursor lives
+// as long as ctx rather than ContextTimeout, a large export takes longer than a single query.
+func (m MovieModel) Stream(ctx context.Context, title string, genres []string, filter Filter, fn func(movie *Movie) error) error {
+	defer m.logSlowQuery("Stream", conditionProperties(title, genres, filter))()
+
+	where, args := movieConditions(title, genres, filter)
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movie
+		%s
+		ORDER BY id`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(&movie); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Update keeps the slug of the movie unless its title or year changed it
+func (m MovieModel) Update(movie *Movie) error {
+	defer m.logSlowQuery("Update", map[string]string{"id": strconv.FormatInt(movie.ID, 10), "version": strconv.Itoa(int(movie.Version))})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	return retrySlug(func() error {
+		return updateMovie(ctx, m.DB, movie)
+	})
+}
+
+// UpdateTx is Update within tx, typically after GetForUpdate locked the movie
+func (m MovieModel) UpdateTx(movie *Movie, tx *sql.Tx) error {
+	defer m.logSlowQuery("UpdateTx", map[string]string{"id": strconv.FormatInt(movie.ID, 10), "version": strconv.Itoa(int(movie.Version))})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	return updateMovie(ctx, tx, movie)
+}
+
+func updateMovie(ctx context.Context, q queryRower, movie *Movie) error {
+	slug := movie.Slug
+
+	if base := Slugify(movie.Title, movie.Year); !hasSlugBase(slug, base) {
+		var err error
+
+		slug, err = uniqueSlug(ctx, q, base, movie.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE movie
+		set title = $1, year = $2, runtime = $3, genres = $4, slug = $5, version = version + 1
+		WHERE id = $6 and version = $7
+		RETURNING version`
+
+	args := []interface{}{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		slug,
+		movie.ID,
+		movie.Version,
+	}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case isDuplicateMovie(err):
+			return ErrDuplicateMovie
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	movie.Slug = slug
+
+	return nil
+}
+
+// GetForUpdate reads a movie and locks its row until tx ends, other transactions
+// locking the same movie wait for it
+func (m MovieModel) GetForUpdate(id int64, tx *sql.Tx) (*Movie, error) {
+	defer m.logSlowQuery("GetForUpdate", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')
+		FROM movie
+		WHERE id = $1
+		FOR UPDATE`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Slug,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.PosterPath,
+		&movie.ExternalID,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// UpdateLocked locks the movie, lets fn change it and saves it in one transaction, so
+// concurrent editors wait for each other instead of failing with ErrEditConflict. An
+// error of fn rolls back and is returned as is.
+func (m MovieModel) UpdateLocked(id int64, fn func(movie *Movie) error) (*Movie, error) {
+	defer m.logSlowQuery("UpdateLocked", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	movie, err := m.GetForUpdate(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fn(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.UpdateTx(movie, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// UpdateGenres removes and adds genres in a single statement working on the stored
+// genres, so concurrent patches of different genres are all kept. A version other than
+// zero must still be the version of the movie. check runs on the merged movie and an
+// error from it rolls the update back.
+func (m MovieModel) UpdateGenres(id int64, version int32, add, remove []string, check func(movie *Movie) error) (*Movie, error) {
+	defer m.logSlowQuery("UpdateGenres", map[string]string{
+		"id":      strconv.FormatInt(id, 10),
+		"version": strconv.Itoa(int(version)),
+		"add":     strings.Join(add, ","),
+		"remove":  strings.Join(remove, ","),
+	})()
+
+	args := []interface{}{id, version}
+	genres := "genres"
+
+	for _, genre := range remove {
+		args = append(args, genre)
+		genres = fmt.Sprintf("array_remove(%s, $%d)", genres, len(args))
+	}
+
+	for _, genre := range add {
+		args = append(args, genre)
+		genres = fmt.Sprintf("array_append(array_remove(%s, $%d), $%d)", genres, len(args), len(args))
+	}
+
+	// An added genre already set keeps its position
+	query := fmt.Sprintf(`
+		UPDATE movie
+		SET genres = ARRAY(
+				SELECT genre FROM unnest(array_cat(genres, %s)) WITH ORDINALITY AS g(genre, n)
+				WHERE genre = ANY(%s)
+				GROUP BY genre
+				ORDER BY min(n)
+			),
+			version = version + 1
+		WHERE id = $1 AND ($2 = 0 OR version = $2)
+		RETURNING id, created_at, title, slug, year, runtime, genres, version, COALESCE(poster_path, ''), COALESCE(external_id, '')`, genres, genres)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var movie Movie
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Slug,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.PosterPath,
+		&movie.ExternalID,
+	)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		// No row was updated, tell a missing movie apart from a stale version
+		_, err = m.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrEditConflict
+	}
+
+	err = check(&movie)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// Upsert inserts the movie or, when a movie with the same external id exists, replaces
+// its fields in a single statement. The slug is kept unless the title or year changed.
+func (m MovieModel) Upsert(movie *Movie) (bool, error) {
+	defer m.logSlowQuery("Upsert", map[string]string{"external_id": movie.ExternalID})()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	base := Slugify(movie.Title, movie.Year)
+
+	// xmax is only zero on a row version written by an insert
+	query := `
+		INSERT INTO movie (external_id, title, year, runtime, genres, slug)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (external_id) DO UPDATE
+		SET title = EXCLUDED.title, year = EXCLUDED.year, runtime = EXCLUDED.runtime, genres = EXCLUDED.genres,
+			slug = CASE WHEN movie.slug ~ ('^' || $7 || '(-[0-9]+)?$') THEN movie.slug ELSE EXCLUDED.slug END,
+			version = movie.version + 1
+		RETURNING id, created_at, slug, version, xmax = 0`
+
+	var created bool
+
+	err := retrySlug(func() error {
+		slug, err := uniqueSlug(ctx, m.DB, base, 0)
+		if err != nil {
+			return err
+		}
+
+		args := []interface{}{movie.ExternalID, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), slug, base}
+
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Slug, &movie.Version, &created)
+	})
+	if err != nil {
+		switch {
+		case isDuplicateMovie(err):
+			return false, ErrDuplicateMovie
+		default:
+			return false, err
+		}
+	}
+
+	return created, nil
+}
+
+func (m MovieModel) Delete(id int64) error {
+	defer m.logSlowQuery("Delete", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Each attempt reports the row it deleted itself, so a retry answers like the first try
+	query := `DELETE FROM movie WHERE id = $1 RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	var deletedID int64
+
+	err := retry(ctx, m.Retries, func() error {
+		return m.DB.QueryRowContext(ctx, query, id).Scan(&deletedID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteVersioned deletes the movie only when it is still at version, ErrEditConflict
+// is returned when the movie has changed since and ErrRecordNotFound when it is gone
+func (m MovieModel) DeleteVersioned(id, version int64) error {
+	defer m.logSlowQuery("DeleteVersioned", map[string]string{"id": strconv.FormatInt(id, 10), "version": strconv.FormatInt(version, 10)})()
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Both EXISTS see the table as it was before the delete
+	query := `
+		WITH deleted AS (
+			DELETE FROM movie WHERE id = $1 AND version = $2 RETURNING id
+		)
+		SELECT EXISTS (SELECT 1 FROM deleted), EXISTS (SELECT 1 FROM movie WHERE id = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	var deleted, exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, id, version).Scan(&deleted, &exists)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case deleted:
+		return nil
+	case !exists:
+		return ErrRecordNotFound
+	default:
+		return ErrEditConflict
+	}
+}
+
+// DeleteBatch deletes the movies with the given ids in a single transaction and returns
+// the ids that were actually deleted, ids without a movie are skipped
+func (m MovieModel) DeleteBatch(ids []int64) ([]int64, error) {
+	defer m.logSlowQuery("DeleteBatch", map[string]string{"ids": strconv.Itoa(len(ids))})()
+
+	query := `DELETE FROM movie WHERE id = ANY($1) RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deleted := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		deleted = append(deleted, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// SetPoster stores the path of the poster relative to the uploads directory
+func (m MovieModel) SetPoster(id int64, posterPath string) error {
+	defer m.logSlowQuery("SetPoster", map[string]string{"id": strconv.FormatInt(id, 10)})()
+
+	query := `UPDATE movie SET poster_path = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	var result sql.Result
+
+	err := retry(ctx, m.Retries, func() (err error) {
+		result, err = m.DB.ExecContext(ctx, query, posterPath, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	updatedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updatedRows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// batchTimeout bounds the transactions writing many movies at once
+func (m MovieModel) batchTimeout() time.Duration {
+	if m.BatchTimeout > 0 {
+		return m.BatchTimeout
+	}
+
+	return m.ContextTimeout
+}
+
+// logSlowQuery starts timing a query, the returned function is deferred and logs a
+// warning with the query name, duration and params when the threshold was exceeded.
+// Every query is logged at debug level.
+func (m MovieModel) logSlowQuery(name string, params map[string]string) func() {
+	start := time.Now()
+
+	return func() {
+		duration := time.Since(start)
+		if m.Logger == nil {
+			return
+		}
+
+		slow := m.SlowQueryThreshold > 0 && duration >= m.SlowQueryThreshold
+		if !slow && !m.Logger.Enabled(context.Background(), slog.LevelDebug) {
+			return
+		}
+
+		keys := make([]string, 0, len(params))
+		for key := range params {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		args := []any{"query", name, "duration", duration.String()}
+		for _, key := range keys {
+			args = append(args, key, params[key])
+		}
+
+		if slow {
+			m.Logger.Warn("slow query", args...)
+			return
+		}
+
+		m.Logger.Debug("query executed", args...)
+	}
+}
+
+// conditionProperties describes the listing filters of a query for the slow query log
+func conditionProperties(title string, genres []string, filter Filter) map[string]string {
+	properties := map[string]string{
+		"title":        title,
+		"q":            filter.Query,
+		"genres":       strings.Join(genres, ","),
+		"genres_match": filter.GenresMatch,
+		"year_from":    strconv.Itoa(filter.YearFrom),
+		"year_to":      strconv.Itoa(filter.YearTo),
+		"runtime_min":  strconv.Itoa(filter.RuntimeMin),
+		"runtime_max":  strconv.Itoa(filter.RuntimeMax),
+		"sort":         filter.Sort,
+		"page":         strconv.Itoa(filter.Page),
+		"page_size":    strconv.Itoa(filter.PageSize),
+	}
+
+	if !filter.CreatedFrom.IsZero() {
+		properties["created_from"] = filter.CreatedFrom.Format(time.RFC3339)
+	}
+
+	if !filter.CreatedTo.IsZero() {
+		properties["created_to"] = filter.CreatedTo.Format(time.RFC3339)
+	}
+
+	if filter.CreatedBy != 0 {
+		properties["created_by"] = strconv.FormatInt(filter.CreatedBy, 10)
+	}
+
+	return properties
+}
@@ -0,0 +1,275 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovieModelGetAllMatchesTitleWords(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Star Wars: Episode IV", Year: 1977, Runtime: 121, Genres: []string{"sci-fi"}},
+		&Movie{Title: "Starship Troopers", Year: 1997, Runtime: 129, Genres: []string{"sci-fi"}},
+	)
+
+	movies, metadata, err := m.GetAll("star wars", []string{}, testFilter())
+	require.NoError(t, err)
+
+	require.Len(t, movies, 1)
+	assert.Equal(t, "Star Wars: Episode IV", movies[0].Title)
+	assert.Equal(t, 1, metadata.TotalRecords)
+}
+
+func TestMovieModelGetAllRuntimeRange(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	insertTestMovies(t, m, &Movie{Title: "The Matrix", Year: 1999, Runtime: 107, Genres: []string{"sci-fi"}})
+
+	filter := testFilter()
+	filter.RuntimeMin, filter.RuntimeMax = 100, 120
+
+	movies, _, err := m.GetAll("", []string{}, filter)
+	require.NoError(t, err)
+	assert.Len(t, movies, 1)
+
+	filter = testFilter()
+	filter.RuntimeMax = 90
+
+	movies, _, err = m.GetAll("", []string{}, filter)
+	require.NoError(t, err)
+	assert.Empty(t, movies)
+}
+
+func TestMovieModelGetAllFuzzyQuery(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}},
+		&Movie{Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"sci-fi"}},
+	)
+
+	filter := testFilter()
+	filter.Query = "gladaitor"
+	filter.SimilarityThreshold = 0.3
+	filter.Sort = "-similarity"
+	filter.SortSafeList = []string{"-similarity"}
+
+	movies, metadata, err := m.GetAll("", []string{}, filter)
+	require.NoError(t, err)
+
+	require.Len(t, movies, 1)
+	assert.Equal(t, "Gladiator", movies[0].Title)
+	assert.Equal(t, 1, metadata.TotalRecords)
+
+	// The exact-ish title filter stays strict about the typo
+	movies, _, err = m.GetAll("gladaitor", []string{}, testFilter())
+	require.NoError(t, err)
+	assert.Empty(t, movies)
+}
+
+func TestMovieModelUpdateGenresConcurrent(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	movie := &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action", "drama"}}
+	insertTestMovies(t, m, movie)
+
+	changes := []struct{ add, remove []string }{
+		{add: []string{"history"}},
+		{add: []string{"war"}},
+		{add: []string{"epic"}},
+		{remove: []string{"drama"}},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(changes))
+
+	for i, change := range changes {
+		wg.Add(1)
+
+		go func(i int, add, remove []string) {
+			defer wg.Done()
+
+			_, errs[i] = m.UpdateGenres(movie.ID, 0, add, remove, func(movie *Movie) error { return nil })
+		}(i, change.add, change.remove)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	stored, err := m.Get(movie.ID)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"action", "history", "war", "epic"}, stored.Genres)
+	assert.Equal(t, movie.Version+int32(len(changes)), stored.Version)
+
+	// A stale version is still a conflict
+	_, err = m.UpdateGenres(movie.ID, movie.Version, []string{"noir"}, nil, func(movie *Movie) error { return nil })
+	assert.ErrorIs(t, err, ErrEditConflict)
+}
+
+func TestMovieModelQueryTimeout(t *testing.T) {
+	m := newTestMovieModel(t)
+	m.ContextTimeout = 100 * time.Millisecond
+
+	movie := &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}}
+	insertTestMovies(t, m, movie)
+
+	// Hold the row lock so the update sleeps until its deadline
+	tx, err := m.DB.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT 1 FROM movie WHERE id = $1 FOR UPDATE", movie.ID)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = m.Update(movie)
+
+	assertDeadlineExceeded(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMovieModelInsertBatchTimeout(t *testing.T) {
+	m := newTestMovieModel(t)
+	m.ContextTimeout = time.Millisecond
+	m.BatchTimeout = 100 * time.Millisecond
+
+	// The uncommitted movie makes the batch wait on the unique title and year
+	tx, err := m.DB.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO movie (title, year, runtime, genres, slug) VALUES ('Gladiator', 2000, 155, '{action}', 'gladiator-2000-locked')`)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = m.InsertBatch([]*Movie{{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}}})
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assertDeadlineExceeded(t, batchErr.Err)
+
+	// The batch ran past ContextTimeout before BatchTimeout stopped it
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestMovieModelImportCancelled(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	movies := []*Movie{
+		{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}},
+		{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}},
+	}
+
+	// The client goes away after the first movie was inserted
+	_, err := m.Import(ctx, func() (*Movie, error) {
+		if len(movies) == 1 {
+			cancel()
+		}
+
+		movie := movies[0]
+		movies = movies[1:]
+
+		return movie, nil
+	}, func(movie *Movie, err error) {})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	count, err := m.Count("", []string{}, testFilter())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestMovieModelStreamOutlivesQueryTimeout(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}},
+		&Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}},
+	)
+
+	// Every movie takes longer to write out than a single query may last
+	m.ContextTimeout = 10 * time.Millisecond
+
+	var titles []string
+
+	err := m.Stream(context.Background(), "", nil, testFilter(), func(movie *Movie) error {
+		time.Sleep(2 * m.ContextTimeout)
+		titles = append(titles, movie.Title)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Gladiator", "Heat"}, titles)
+}
+
+func TestMovieModelGenreCounts(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action", "drama"}},
+		&Movie{Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+		&Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+		&Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+		&Movie{Title: "Die Hard", Year: 1988, Runtime: 132, Genres: []string{"action"}},
+	)
+
+	counts, err := m.GenreCounts(1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"action": 3, "drama": 2, "sci-fi": 2, "crime": 1, "horror": 1}, counts)
+
+	counts, err = m.GenreCounts(2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"action": 3, "drama": 2, "sci-fi": 2}, counts)
+}
+
+func TestMovieModelDashboardStats(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	stats, err := m.DashboardStats()
+	require.NoError(t, err)
+	assert.Equal(t, DashboardStats{Decades: []DecadeCount{}, TopGenres: []GenreCount{}}, stats)
+
+	insertTestMovies(t, m,
+		&Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action", "drama"}},
+		&Movie{Title: "The Matrix", Year: 1999, Runtime: 136, Genres: []string{"action", "sci-fi"}},
+		&Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+		&Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+		&Movie{Title: "Die Hard", Year: 1988, Runtime: 132, Genres: []string{"action", "thriller"}},
+	)
+
+	stats, err = m.DashboardStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, DashboardStats{
+		TotalMovies:    5,
+		AverageRuntime: 142,
+		MinYear:        1979,
+		MaxYear:        2000,
+		Decades: []DecadeCount{
+			{Decade: 1970, Count: 1},
+			{Decade: 1980, Count: 1},
+			{Decade: 1990, Count: 2},
+			{Decade: 2000, Count: 1},
+		},
+		TopGenres: []GenreCount{
+			{Genre: "action", Count: 3},
+			{Genre: "drama", Count: 2},
+			{Genre: "sci-fi", Count: 2},
+			{Genre: "crime", Count: 1},
+			{Genre: "horror", Count: 1},
+		},
+	}, stats)
+}
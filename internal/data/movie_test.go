@@ -0,0 +1,114 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/harryng22/moviedb/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validTestMovie passes ValidateMovie, tests change the field they check
+func validTestMovie() *Movie {
+	return &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action", "drama"}}
+}
+
+func TestValidateMovieRuntime(t *testing.T) {
+	movie := validTestMovie()
+	movie.Runtime = -5
+
+	v := validator.New()
+	ValidateMovie(v, movie)
+
+	assert.Equal(t, "must be a positive integer", v.Errors["runtime"])
+}
+
+func TestValidateMovieGenres(t *testing.T) {
+	tests := []struct {
+		name    string
+		genres  []string
+		wantErr string
+	}{
+		{name: "valid", genres: []string{"action", "drama"}},
+		{name: "duplicate", genres: []string{"action", "action"}, wantErr: "must not contain duplicate values"},
+		{name: "empty", genres: []string{}, wantErr: "must contain at least 1 genres"},
+		{name: "over limit", genres: []string{"action", "drama", "crime", "history", "war", "sci-fi"}, wantErr: "must not contain more than 5 genres"},
+		{name: "blank entry", genres: []string{"action", " "}, wantErr: "must not contain blank values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := validTestMovie()
+			movie.Genres = tt.genres
+
+			v := validator.New()
+			ValidateMovie(v, movie)
+
+			assert.Equal(t, tt.wantErr, v.Errors["genres"])
+		})
+	}
+}
+
+func TestMergeGenres(t *testing.T) {
+	tests := []struct {
+		name        string
+		genres      []string
+		add, remove []string
+		want        []string
+	}{
+		{name: "add", genres: []string{"action"}, add: []string{"drama"}, want: []string{"action", "drama"}},
+		{name: "remove", genres: []string{"action", "drama"}, remove: []string{"action"}, want: []string{"drama"}},
+		{name: "add already set keeps its position", genres: []string{"action", "drama"}, add: []string{"action", "war"}, want: []string{"action", "drama", "war"}},
+		{name: "remove missing", genres: []string{"action"}, remove: []string{"war"}, want: []string{"action"}},
+		{name: "stored duplicates", genres: []string{"action", "action"}, want: []string{"action"}},
+		{name: "remove every genre", genres: []string{"action"}, remove: []string{"action"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MergeGenres(tt.genres, tt.add, tt.remove))
+		})
+	}
+}
+
+func TestMovieMarshalJSON(t *testing.T) {
+	createdAt := Timestamp{time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name  string
+		movie Movie
+		want  string
+	}{
+		{
+			name:  "complete",
+			movie: Movie{ID: 1, CreatedAt: createdAt, Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}, Version: 2},
+			want:  `{"id":1,"create_at":"2024-03-01T09:30:00Z","title":"Gladiator","year":2000,"runtime":"155 mins","genres":["action"],"version":2}`,
+		},
+		{
+			name:  "zero year and runtime",
+			movie: Movie{ID: 1, CreatedAt: createdAt, Title: "Gladiator", Genres: []string{"action"}, Version: 1},
+			want:  `{"id":1,"create_at":"2024-03-01T09:30:00Z","title":"Gladiator","genres":["action"],"version":1}`,
+		},
+		{
+			name:  "nil genres",
+			movie: Movie{ID: 1, CreatedAt: createdAt, Title: "Gladiator", Version: 1},
+			want:  `{"id":1,"create_at":"2024-03-01T09:30:00Z","title":"Gladiator","genres":[],"version":1}`,
+		},
+		{
+			name:  "empty title",
+			movie: Movie{CreatedAt: createdAt},
+			want:  `{"id":0,"create_at":"2024-03-01T09:30:00Z","title":"","genres":[],"version":0}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.movie)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
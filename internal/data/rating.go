@@ -0,0 +1,15 @@
+package data
+
+import "github.com/harryng22/moviedb/internal/validator"
+
+type Rating struct {
+	UserID  int64 `json:"user_id"`
+	MovieID int64 `json:"movie_id"`
+	Score   int32 `json:"score"`
+	Version int32 `json:"version"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score >= 1, "score", "must be at least 1")
+	v.Check(rating.Score <= 10, "score", "must not be more than 10")
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// highScore is the lowest score counted as rating a movie highly for recommendations
+const highScore = 8
+
+// Rating Model
+type RatingModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+func (m RatingModel) Get(userID, movieID int64) (*Rating, error) {
+	query := `
+		SELECT user_id, movie_id, score, version
+		FROM ratings
+		WHERE user_id = $1 AND movie_id = $2`
+
+	var rating Rating
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(
+		&rating.UserID,
+		&rating.MovieID,
+		&rating.Score,
+		&rating.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rating, nil
+}
+
+// Upsert inserts a new rating when its version is zero and otherwise updates the
+// rating with a matching version, ErrEditConflict is returned when either races
+func (m RatingModel) Upsert(rating *Rating) error {
+	query := `
+		INSERT INTO ratings (user_id, movie_id, score)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, movie_id) DO NOTHING
+		RETURNING version`
+
+	args := []interface{}{rating.UserID, rating.MovieID, rating.Score}
+
+	if rating.Version != 0 {
+		query = `
+			UPDATE ratings
+			SET score = $3, version = version + 1
+			WHERE user_id = $1 AND movie_id = $2 AND version = $4
+			RETURNING version`
+
+		args = append(args, rating.Version)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&rating.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AverageForMovie computes the average score on every call, it returns 0 when the movie has no ratings
+func (m RatingModel) AverageForMovie(movieID int64) (float64, int, error) {
+	query := `
+		SELECT COALESCE(AVG(score), 0), count(*)
+		FROM ratings
+		WHERE movie_id = $1`
+
+	var (
+		average float64
+		count   int
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID).Scan(&average, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return average, count, nil
+}
+
+// Recommendations returns the movies rated highly by the users who rated the movie highly,
+// the movies most of them agree on first
+func (m RatingModel) Recommendations(movieID int64, limit int) ([]*Movie, error) {
+	query := `
+		SELECT m.id, m.created_at, m.title, m.slug, m.year, m.runtime, m.genres, m.version
+		FROM ratings source
+		INNER JOIN ratings other ON other.user_id = source.user_id AND other.movie_id <> source.movie_id
+		INNER JOIN movie m ON m.id = other.movie_id
+		WHERE source.movie_id = $1 AND source.score >= $2 AND other.score >= $2
+		GROUP BY m.id
+		ORDER BY count(*) DESC, avg(other.score) DESC, m.id ASC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, highScore, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Slug,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
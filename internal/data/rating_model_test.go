@@ -0,0 +1,53 @@
+package data
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingModelUpsertConflict(t *testing.T) {
+	m := NewModel(newTestDB(t), 3*time.Second, 10*time.Second, 3, nil, 0)
+
+	user := insertTestUser(t, m, "alice@example.com")
+	movie := &Movie{Title: "Gladiator", Year: 2000, Runtime: 155, Genres: []string{"action"}}
+	insertTestMovies(t, m.Movie, movie)
+
+	rating := &Rating{UserID: user.ID, MovieID: movie.ID, Score: 5}
+	require.NoError(t, m.Rating.Upsert(rating))
+
+	// Both updates read version 1, only one of them may apply
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+
+	for i := range errs {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			update := *rating
+			update.Score = int32(6 + i)
+			errs[i] = m.Rating.Upsert(&update)
+		}(i)
+	}
+
+	wg.Wait()
+
+	conflicts := 0
+	for _, err := range errs {
+		if err != nil {
+			assert.ErrorIs(t, err, ErrEditConflict)
+			conflicts++
+		}
+	}
+
+	assert.Equal(t, 1, conflicts)
+
+	stored, err := m.Rating.Get(user.ID, movie.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), stored.Version)
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// retryBaseDelay is the wait before the first retry, it doubles after every attempt
+const retryBaseDelay = 50 * time.Millisecond
+
+// retry runs fn again while it fails with a transient error, up to retries more times.
+// The waits between attempts are bounded by ctx so the query timeout still caps the total time.
+func retry(ctx context.Context, retries int, fn func() error) error {
+	delay := retryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is worth retrying: lost connections, a server shutting
+// down, and serialization failures or deadlocks. Missing rows and constraint violations are not.
+func isTransient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08":
+			return true
+		case pqErr.Code == "40001", pqErr.Code == "40P01", pqErr.Code == "57P01":
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, driver.ErrBadConn):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	case errors.As(err, &netErr):
+		return !netErr.Timeout()
+	default:
+		return false
+	}
+}
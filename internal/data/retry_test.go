@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver answers every statement with exec, so tests can script failures without a
+// database. A query returns as many rows of its first argument as the result affected.
+type fakeDriver struct {
+	exec func(query string, args []driver.NamedValue) (driver.Result, error)
+}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{d}, nil
+}
+
+func (d fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeConn{d}, nil
+}
+
+func (d fakeDriver) Driver() driver.Driver {
+	return d
+}
+
+type fakeConn struct {
+	driver fakeDriver
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.driver.exec(query, args)
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.driver.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	var value driver.Value
+	if len(args) > 0 {
+		value = args[0].Value
+	}
+
+	return &fakeRows{remaining: n, value: value}, nil
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDriver: prepared statements are not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakeDriver: transactions are not supported")
+}
+
+// fakeRows returns remaining rows of a single column holding value
+type fakeRows struct {
+	remaining int64
+	value     driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+
+	r.remaining--
+	dest[0] = r.value
+
+	return nil
+}
+
+// newFakeMovieModel returns a movie model whose statements are answered by exec
+func newFakeMovieModel(t *testing.T, exec func(query string, args []driver.NamedValue) (driver.Result, error)) MovieModel {
+	t.Helper()
+
+	db := sql.OpenDB(fakeDriver{exec: exec})
+	t.Cleanup(func() { db.Close() })
+
+	return MovieModel{DB: db, ContextTimeout: 3 * time.Second, Retries: 3}
+}
+
+func TestMovieModelDeleteRetries(t *testing.T) {
+	connectionFailure := &pq.Error{Code: "08006"}
+	uniqueViolation := &pq.Error{Code: "23505"}
+
+	tests := []struct {
+		name         string
+		results      []driver.Result
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{
+			name:         "deleted",
+			results:      []driver.Result{driver.RowsAffected(1)},
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name:         "missing",
+			results:      []driver.Result{driver.RowsAffected(0)},
+			errs:         []error{nil},
+			wantErr:      ErrRecordNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:         "fails then succeeds",
+			results:      []driver.Result{nil, driver.RowsAffected(1)},
+			errs:         []error{connectionFailure, nil},
+			wantAttempts: 2,
+		},
+		{
+			// A retry deleting nothing reports it like a first attempt would
+			name:         "fails then missing",
+			results:      []driver.Result{nil, driver.RowsAffected(0)},
+			errs:         []error{connectionFailure, nil},
+			wantErr:      ErrRecordNotFound,
+			wantAttempts: 2,
+		},
+		{
+			name:         "gives up",
+			results:      []driver.Result{nil, nil, nil, nil},
+			errs:         []error{connectionFailure, connectionFailure, connectionFailure, connectionFailure},
+			wantErr:      connectionFailure,
+			wantAttempts: 4,
+		},
+		{
+			name:         "permanent error",
+			results:      []driver.Result{nil},
+			errs:         []error{uniqueViolation},
+			wantErr:      uniqueViolation,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+
+			m := newFakeMovieModel(t, func(query string, args []driver.NamedValue) (driver.Result, error) {
+				require.Less(t, attempts, len(tt.errs), "unexpected attempt")
+
+				result, err := tt.results[attempts], tt.errs[attempts]
+				attempts++
+
+				return result, err
+			})
+
+			err := m.Delete(1)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"unicode/utf8"
+
+	"github.com/harryng22/moviedb/internal/validator"
+)
+
+// Review is the text a user wrote about a movie, it is only listed publicly once approved
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Body      string    `json:"body"`
+	CreatedAt Timestamp `json:"created_at"`
+	Version   int32     `json:"version"`
+	Approved  bool      `json:"approved"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(utf8.RuneCountInString(review.Body) <= 5000, "body", "must not be more than 5000 characters long")
+}
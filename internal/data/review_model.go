@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Review Model
+type ReviewModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version, approved`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, review.MovieID, review.UserID, review.Body).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.Version,
+		&review.Approved,
+	)
+}
+
+func (m ReviewModel) Get(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, movie_id, user_id, body, created_at, version, approved
+		FROM reviews
+		WHERE id = $1`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.Body,
+		&review.CreatedAt,
+		&review.Version,
+		&review.Approved,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// ListForMovie returns the reviews of the movie oldest first, unapproved reviews are
+// only included when asked for
+func (m ReviewModel) ListForMovie(movieID int64, includeUnapproved bool, filter Filter) ([]*Review, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, movie_id, user_id, body, created_at, version, approved
+		FROM reviews
+		WHERE movie_id = $1 AND (approved OR $2)
+		ORDER BY id ASC
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, includeUnapproved, filter.limit(), filter.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Body,
+			&review.CreatedAt,
+			&review.Version,
+			&review.Approved,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return reviews, calculateMetadata(totalRecords, filter.Page, filter.PageSize), nil
+}
+
+// Approve publishes the review, ErrEditConflict is returned when it changed since it was read
+func (m ReviewModel) Approve(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET approved = true, version = version + 1
+		WHERE id = $1 AND version = $2
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, review.ID, review.Version).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	review.Approved = true
+
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM reviews WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	deletedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deletedRows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -1,8 +1,11 @@
 package data
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -11,6 +14,7 @@ var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
 type Runtime int32
 
+// MarshalJSON is never called for a zero runtime of a Movie, the omitempty tag drops it first
 func (r Runtime) MarshalJSON() ([]byte, error) {
 	jsonValue := fmt.Sprintf("%d mins", r)
 
@@ -19,24 +23,103 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 	return []byte(quotedJsonValue), nil
 }
 
+// ISO8601 formats the runtime as an ISO 8601 duration, e.g. 107 minutes is "PT1H47M"
+func (r Runtime) ISO8601() string {
+	hours, minutes := int32(r)/60, int32(r)%60
+
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("PT%dM", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("PT%dH", hours)
+	default:
+		return fmt.Sprintf("PT%dH%dM", hours, minutes)
+	}
+}
+
+func (r Runtime) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(fmt.Sprintf("%d mins", r), start)
+}
+
+var (
+	hoursMinutesRX = regexp.MustCompile(`^(?:([0-9]+)h)?(?:([0-9]+)m)?$`)
+	clockRX        = regexp.MustCompile(`^([0-9]+):([0-9]{2})$`)
+)
+
+// UnmarshalJSON accepts "107 mins", "1h47m" and "1:47". Minutes past an hour must be
+// below 60 in the last two, so "1h75m" and "1:75" are rejected as ambiguous.
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	unquotedJsonValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotedJsonValue, " ")
-
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	minutes, err := parseRuntime(unquotedJsonValue)
+	if err != nil {
+		return err
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	*r = Runtime(minutes)
+
+	return nil
+}
+
+// ParseRuntime reads a runtime outside of JSON, such as a CSV cell. Besides the formats
+// of UnmarshalJSON it accepts a bare number of minutes, as written by the CSV export.
+func ParseRuntime(s string) (Runtime, error) {
+	minutes, err := positiveMinutes("", s, false)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		minutes, err = parseRuntime(s)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	*r = Runtime(i)
+	return Runtime(minutes), nil
+}
 
-	return nil
+func parseRuntime(s string) (int64, error) {
+	if parts := strings.Split(s, " "); len(parts) == 2 && parts[1] == "mins" {
+		return positiveMinutes("", parts[0], false)
+	}
+
+	if match := hoursMinutesRX.FindStringSubmatch(s); match != nil && s != "" {
+		return positiveMinutes(match[1], match[2], match[1] != "")
+	}
+
+	if match := clockRX.FindStringSubmatch(s); match != nil {
+		return positiveMinutes(match[1], match[2], true)
+	}
+
+	return 0, ErrInvalidRuntimeFormat
+}
+
+// positiveMinutes adds up hours and minutes, either may be empty. With capped set the
+// minutes must be below 60.
+func positiveMinutes(hours, minutes string, capped bool) (int64, error) {
+	total := int64(0)
+
+	if hours != "" {
+		h, err := strconv.ParseInt(hours, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRuntimeFormat
+		}
+
+		total = h * 60
+	}
+
+	if minutes != "" {
+		m, err := strconv.ParseInt(minutes, 10, 32)
+		if err != nil || (capped && m >= 60) {
+			return 0, ErrInvalidRuntimeFormat
+		}
+
+		total += m
+	}
+
+	if total <= 0 || total > math.MaxInt32 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return total, nil
 }
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    *Runtime
+		wantErr error
+	}{
+		{name: "zero", json: `"0 mins"`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "negative", json: `"-5 mins"`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "minutes", json: `"107 mins"`, want: runtimePtr(107)},
+		{name: "bare number", json: `107`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "null", json: `null`},
+		{name: "hours and minutes", json: `"1h47m"`, want: runtimePtr(107)},
+		{name: "hours", json: `"2h"`, want: runtimePtr(120)},
+		{name: "clock", json: `"2:15"`, want: runtimePtr(135)},
+		{name: "ninety minutes", json: `"90 mins"`, want: runtimePtr(90)},
+		{name: "letters", json: `"abc"`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "ambiguous minutes", json: `"1h75m"`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "ambiguous clock", json: `"1:75"`, wantErr: ErrInvalidRuntimeFormat},
+		{name: "empty", json: `""`, wantErr: ErrInvalidRuntimeFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				Runtime *Runtime `json:"runtime"`
+			}
+
+			err := json.Unmarshal([]byte(`{"runtime":`+tt.json+`}`), &input)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, input.Runtime)
+		})
+	}
+}
+
+func runtimePtr(minutes int32) *Runtime {
+	r := Runtime(minutes)
+	return &r
+}
+
+func TestRuntimeISO8601(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		want    string
+	}{
+		{runtime: 107, want: "PT1H47M"},
+		{runtime: 60, want: "PT1H"},
+		{runtime: 45, want: "PT45M"},
+		{runtime: 120, want: "PT2H"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.runtime.ISO8601())
+		})
+	}
+}
+
+func TestMovieMarshalJSONRuntimeFormat(t *testing.T) {
+	movie := Movie{ID: 1, Title: "Gladiator", Runtime: 107, RuntimeFormat: RuntimeFormatISO8601}
+
+	got, err := json.Marshal(movie)
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(got, &fields))
+	assert.Equal(t, "PT1H47M", fields["runtime"])
+
+	movie.RuntimeFormat = RuntimeFormatMins
+
+	got, err = json.Marshal(movie)
+	require.NoError(t, err)
+
+	require.NoError(t, json.Unmarshal(got, &fields))
+	assert.Equal(t, "107 mins", fields["runtime"])
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovieModelLogsSlowQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		wantLogs int
+	}{
+		{name: "slow", delay: 50 * time.Millisecond, wantLogs: 1},
+		{name: "fast", delay: 0, wantLogs: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			m := newFakeMovieModel(t, func(query string, args []driver.NamedValue) (driver.Result, error) {
+				time.Sleep(tt.delay)
+				return driver.RowsAffected(1), nil
+			})
+			m.Logger = slog.New(slog.NewJSONHandler(&out, nil))
+			m.SlowQueryThreshold = 20 * time.Millisecond
+
+			require.NoError(t, m.Delete(42))
+
+			if tt.wantLogs == 0 {
+				assert.Empty(t, out.String())
+				return
+			}
+
+			lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+			require.Len(t, lines, tt.wantLogs)
+
+			var line map[string]string
+			require.NoError(t, json.Unmarshal(lines[0], &line))
+
+			assert.Equal(t, "WARN", line["level"])
+			assert.Equal(t, "slow query", line["msg"])
+			assert.Equal(t, "Delete", line["query"])
+			assert.Equal(t, "42", line["id"])
+
+			duration, err := time.ParseDuration(line["duration"])
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, duration, m.SlowQueryThreshold)
+		})
+	}
+}
+
+func TestMovieModelLogsQueriesAtDebugLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	level := new(slog.LevelVar)
+
+	m := newFakeMovieModel(t, func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return driver.RowsAffected(1), nil
+	})
+	m.Logger = slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: level}))
+
+	// Silent at the default info level
+	require.NoError(t, m.Delete(42))
+	assert.Empty(t, out.String())
+
+	// Lowering the level of the running logger turns the query logs on
+	level.Set(slog.LevelDebug)
+
+	require.NoError(t, m.Delete(42))
+
+	var line map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line), out.String())
+
+	assert.Equal(t, "DEBUG", line["level"])
+	assert.Equal(t, "query executed", line["msg"])
+	assert.Equal(t, "Delete", line["query"])
+	assert.Equal(t, "42", line["id"])
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var nonAlphanumericRX = regexp.MustCompile("[^a-z0-9]+")
+
+// slugAttempts bounds how many times a write picks a new slug after losing it to a
+// concurrent write of a movie with the same slug
+const slugAttempts = 5
+
+// Slugify builds the URL slug of a movie from its title and year, e.g. "Dune: Part Two"
+// from 2024 becomes "dune-part-two-2024"
+func Slugify(title string, year int32) string {
+	slug := nonAlphanumericRX.ReplaceAllString(strings.ToLower(title)+" "+strconv.Itoa(int(year)), "-")
+
+	return strings.Trim(slug, "-")
+}
+
+// hasSlugBase reports whether slug is base itself or base with a numeric suffix
+func hasSlugBase(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+
+	suffix := strings.TrimPrefix(slug, base+"-")
+	if suffix == slug {
+		return false
+	}
+
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// uniqueSlug returns base when no other movie uses it, and otherwise base followed by
+// the next free numeric suffix, starting at 2
+func uniqueSlug(ctx context.Context, q queryRower, base string, excludeID int64) (string, error) {
+	query := `
+		SELECT COALESCE(MAX(CASE WHEN slug = $1 THEN 1 ELSE substring(slug from '-([0-9]+)$')::int END), 0)
+		FROM movie
+		WHERE slug ~ ('^' || $1 || '(-[0-9]+)?$') AND id <> $2`
+
+	var taken int
+
+	err := q.QueryRowContext(ctx, query, base, excludeID).Scan(&taken)
+	if err != nil {
+		return "", err
+	}
+
+	if taken == 0 {
+		return base, nil
+	}
+
+	return base + "-" + strconv.Itoa(taken+1), nil
+}
+
+// retrySlug runs fn again while it fails because a concurrent write took its slug, fn must
+// pick the slug with uniqueSlug on every run. It cannot be used within a transaction, the
+// failed statement aborts it.
+func retrySlug(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !isDuplicateSlug(err) || attempt >= slugAttempts {
+			return err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		year  int32
+		want  string
+	}{
+		{title: "Dune", year: 2021, want: "dune-2021"},
+		{title: "Dune: Part Two", year: 2024, want: "dune-part-two-2024"},
+		{title: "Ocean's Eleven", year: 2001, want: "ocean-s-eleven-2001"},
+		{title: "  Mission: Impossible -- Fallout!  ", year: 2018, want: "mission-impossible-fallout-2018"},
+		{title: "WALL·E", year: 2008, want: "wall-e-2008"},
+		{title: "Se7en", year: 1995, want: "se7en-1995"},
+		{title: "?!", year: 2000, want: "2000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, Slugify(tt.title, tt.year))
+		})
+	}
+}
+
+func TestHasSlugBase(t *testing.T) {
+	assert.True(t, hasSlugBase("heat-1995", "heat-1995"))
+	assert.True(t, hasSlugBase("heat-1995-3", "heat-1995"))
+	assert.False(t, hasSlugBase("heat-1995-extended", "heat-1995"))
+	assert.False(t, hasSlugBase("heat-1996", "heat-1995"))
+}
+
+func TestMovieModelInsertConcurrentSlugs(t *testing.T) {
+	m := newTestMovieModel(t)
+
+	// Every title has the slug heat-1995, each round of attempts is won by at least one insert
+	titles := []string{"Heat", "Heat!", "Heat?", "Heat.", "(Heat)"}
+	movies := make([]*Movie, len(titles))
+	errs := make([]error, len(titles))
+
+	var wg sync.WaitGroup
+
+	for i, title := range titles {
+		movies[i] = &Movie{Title: title, Year: 1995, Runtime: 170, Genres: []string{"crime"}}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.Insert(movies[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	slugs := make(map[string]bool)
+
+	for i := range titles {
+		require.NoError(t, errs[i], titles[i])
+		assert.True(t, hasSlugBase(movies[i].Slug, "heat-1995"), movies[i].Slug)
+
+		slugs[movies[i].Slug] = true
+	}
+
+	assert.Len(t, slugs, len(titles))
+}
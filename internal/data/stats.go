@@ -0,0 +1,29 @@
+package data
+
+// DashboardStats are the catalogue totals shown on the admin dashboard, the year bounds
+// and average runtime are zero for an empty catalogue
+type DashboardStats struct {
+	TotalMovies    int           `json:"total_movies"`
+	AverageRuntime float64       `json:"average_runtime"`
+	MinYear        int32         `json:"min_year"`
+	MaxYear        int32         `json:"max_year"`
+	Decades        []DecadeCount `json:"decades"`
+	TopGenres      []GenreCount  `json:"top_genres"`
+}
+
+// DecadeCount is the number of movies released in the decade starting with Decade, e.g. 1990
+type DecadeCount struct {
+	Decade int32 `json:"decade"`
+	Count  int   `json:"count"`
+}
+
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// YearCount is the number of movies released in Year
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int   `json:"count"`
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB opens the database of MOVIEDB_TEST_DSN in a schema of its own with every
+// migration applied, the schema is dropped when the test ends. Tests needing a
+// database are skipped when MOVIEDB_TEST_DSN is not set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("MOVIEDB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MOVIEDB_TEST_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+	})
+
+	// The extensions may already be installed in public
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.up.sql"))
+	require.NoError(t, err)
+	sort.Strings(migrations)
+
+	for _, migration := range migrations {
+		query, err := os.ReadFile(migration)
+		require.NoError(t, err)
+
+		_, err = db.Exec(string(query))
+		require.NoError(t, err, migration)
+	}
+
+	return db
+}
+
+// withSearchPath adds the search_path run-time parameter to a URL or key=value DSN
+func withSearchPath(dsn, searchPath string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", searchPath)
+			u.RawQuery = query.Encode()
+
+			return u.String()
+		}
+	}
+
+	return dsn + " search_path=" + searchPath
+}
+
+// newTestMovieModel returns the movie model of a test database
+func newTestMovieModel(t *testing.T) MovieModel {
+	t.Helper()
+
+	return MovieModel{DB: newTestDB(t), ContextTimeout: 3 * time.Second, Retries: 3}
+}
+
+// testFilter is the first page of a listing sorted by id
+func testFilter() Filter {
+	return Filter{
+		Page:         1,
+		PageSize:     20,
+		MaxPageSize:  100,
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+		GenresMatch:  "all",
+	}
+}
+
+// insertTestMovies stores the movies in m and fails the test on the first error
+func insertTestMovies(t *testing.T, m interface{ Insert(movie *Movie) error }, movies ...*Movie) {
+	t.Helper()
+
+	for _, movie := range movies {
+		require.NoError(t, m.Insert(movie))
+	}
+}
+
+// insertTestUser stores an activated user with the email in m and returns it
+func insertTestUser(t *testing.T, m Model, email string) *User {
+	t.Helper()
+
+	user := &User{Name: "Test User", Email: email, Activated: true}
+	require.NoError(t, user.Password.Set("pa55word1234"))
+	require.NoError(t, m.User.Insert(user))
+
+	return user
+}
+
+// assertDeadlineExceeded checks that err comes from a query stopped by the deadline of its
+// context, lib/pq reports the cancelled statement rather than context.DeadlineExceeded
+func assertDeadlineExceeded(t *testing.T, err error) {
+	t.Helper()
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		assert.Equal(t, pq.ErrorCode("57014"), pqErr.Code, "expected query_canceled, got %s", err)
+		return
+	}
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
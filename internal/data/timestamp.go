@@ -0,0 +1,55 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Timestamp is a time.Time marshaled as RFC 3339 with whole seconds, e.g.
+// "2024-03-01T09:30:00Z", some clients cannot parse the nanoseconds of time.Time
+type Timestamp struct {
+	time.Time
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(t.Format(time.RFC3339))), nil
+}
+
+// UnmarshalJSON accepts any RFC 3339 time, fractional seconds included
+func (t *Timestamp) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJsonValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return fmt.Errorf("timestamp must be an RFC 3339 string")
+	}
+
+	parsed, err := time.Parse(time.RFC3339, unquotedJsonValue)
+	if err != nil {
+		return fmt.Errorf("timestamp must be an RFC 3339 string")
+	}
+
+	t.Time = parsed
+
+	return nil
+}
+
+func (t Timestamp) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(t.Format(time.RFC3339), start)
+}
+
+func (t *Timestamp) Scan(value interface{}) error {
+	parsed, ok := value.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Timestamp", value)
+	}
+
+	t.Time = parsed
+
+	return nil
+}
+
+func (t Timestamp) Value() (driver.Value, error) {
+	return t.Time, nil
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{name: "whole seconds", time: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), want: `"2024-03-01T09:30:00Z"`},
+		{name: "nanoseconds dropped", time: time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.UTC), want: `"2024-03-01T09:30:15Z"`},
+		{name: "offset kept", time: time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("", 2*60*60)), want: `"2024-03-01T09:30:00+02:00"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(Timestamp{tt.time})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(js))
+		})
+	}
+}
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "whole seconds", json: `"2024-03-01T09:30:00Z"`, want: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{name: "fractional seconds", json: `"2024-03-01T09:30:15.5Z"`, want: time.Date(2024, 3, 1, 9, 30, 15, 500000000, time.UTC)},
+		{name: "date only", json: `"2024-03-01"`, wantErr: true},
+		{name: "number", json: `1709285400`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Timestamp
+			err := json.Unmarshal([]byte(tt.json), &got)
+
+			if tt.wantErr {
+				assert.EqualError(t, err, "timestamp must be an RFC 3339 string")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got.Time), "got %s", got.Time)
+		})
+	}
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	want := Timestamp{time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)}
+
+	js, err := json.Marshal(want)
+	require.NoError(t, err)
+
+	var got Timestamp
+	require.NoError(t, json.Unmarshal(js, &got))
+	assert.True(t, want.Equal(got.Time))
+}
+
+func TestTimestampMarshalXML(t *testing.T) {
+	doc := struct {
+		XMLName   xml.Name  `xml:"movie"`
+		CreatedAt Timestamp `xml:"created_at"`
+	}{CreatedAt: Timestamp{time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.UTC)}}
+
+	out, err := xml.Marshal(doc)
+	require.NoError(t, err)
+	assert.Equal(t, "<movie><created_at>2024-03-01T09:30:15Z</created_at></movie>", string(out))
+}
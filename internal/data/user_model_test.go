@@ -0,0 +1,34 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserModelRegister(t *testing.T) {
+	db := newTestDB(t)
+	m := NewModel(db, 3*time.Second, 10*time.Second, 3, nil, 0)
+
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, user.Password.Set("pa55word1234"))
+
+	token, err := m.User.Register(user, []string{"movies:read"}, time.Hour)
+	require.NoError(t, err)
+
+	activated, err := m.Token.GetForToken(ScopeActivation, token.Plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, activated.ID)
+
+	permissions, err := m.Permission.GetAllForUser(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Permissions{"movies:read"}, permissions)
+
+	duplicate := &User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, duplicate.Password.Set("pa55word1234"))
+
+	_, err = m.User.Register(duplicate, []string{"movies:read"}, time.Hour)
+	assert.ErrorIs(t, err, ErrDuplicateEmail)
+}
@@ -0,0 +1,8 @@
+package data
+
+// WatchlistEntry is a movie on the watchlist of a user, WatchedAt is only set once watched
+type WatchlistEntry struct {
+	Movie     *Movie     `json:"movie"`
+	Watched   bool       `json:"watched"`
+	WatchedAt *Timestamp `json:"watched_at,omitempty"`
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Watchlist Model
+type WatchlistModel struct {
+	DB             *sql.DB
+	ContextTimeout time.Duration
+}
+
+// Set adds the movie to the watchlist of the user or updates its watched state,
+// watched_at records when the movie was last marked watched
+func (m WatchlistModel) Set(userID, movieID int64, watched bool) error {
+	query := `
+		INSERT INTO watchlist (user_id, movie_id, watched, watched_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 THEN NOW() END)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET watched = EXCLUDED.watched, watched_at = EXCLUDED.watched_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, movieID, watched)
+	return err
+}
+
+// IsWatched reports whether the user marked the movie watched, a movie missing from the watchlist is not
+func (m WatchlistModel) IsWatched(userID, movieID int64) (bool, error) {
+	query := `
+		SELECT watched
+		FROM watchlist
+		WHERE user_id = $1 AND movie_id = $2`
+
+	var watched bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&watched)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return watched, nil
+}
+
+// ListForUser returns the watchlist of the user, a nil watched returns every entry
+func (m WatchlistModel) ListForUser(userID int64, watched *bool) ([]*WatchlistEntry, error) {
+	query := `
+		SELECT m.id, m.created_at, m.title, m.year, m.runtime, m.genres, m.version, w.watched, w.watched_at
+		FROM watchlist w
+		INNER JOIN movie m ON m.id = w.movie_id
+		WHERE w.user_id = $1 AND ($2::boolean IS NULL OR w.watched = $2)
+		ORDER BY w.watched_at DESC NULLS FIRST, m.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.ContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, watched)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*WatchlistEntry{}
+
+	for rows.Next() {
+		var (
+			movie     Movie
+			entry     WatchlistEntry
+			watchedAt sql.NullTime
+		)
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&entry.Watched,
+			&watchedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Movie = &movie
+		if watchedAt.Valid {
+			entry.WatchedAt = &Timestamp{watchedAt.Time}
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -1,17 +1,38 @@
 package validator
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
+// Machine readable codes reported alongside the error messages
+const (
+	CodeInvalid       = "invalid"
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeTooShort      = "too_short"
+	CodeOutOfRange    = "out_of_range"
+	CodeInvalidFormat = "invalid_format"
+	CodeDuplicate     = "duplicate"
+)
+
 type Validator struct {
 	Errors map[string]string
+	Codes  map[string]string
+}
+
+// FieldError is the message and code recorded for a single field
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string]string), Codes: make(map[string]string)}
 }
 
 func (v *Validator) Valid() bool {
@@ -19,17 +40,45 @@ func (v *Validator) Valid() bool {
 }
 
 func (v *Validator) AddError(key, message string) {
+	v.AddErrorCode(key, CodeInvalid, message)
+}
+
+// AddErrorCode records the error unless the field already has one
+func (v *Validator) AddErrorCode(key, code, message string) {
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.Codes[key] = code
 	}
 }
 
 func (v *Validator) Check(ok bool, key, messasge string) {
+	v.CheckCode(ok, key, CodeInvalid, messasge)
+}
+
+// CheckCode records the error when ok is false, replacing any earlier error of the field
+func (v *Validator) CheckCode(ok bool, key, code, message string) {
 	if !ok {
-		v.Errors[key] = messasge
+		v.Errors[key] = message
+		v.Codes[key] = code
 	}
 }
 
+// Details returns the errors with their codes keyed by field
+func (v *Validator) Details() map[string]FieldError {
+	details := make(map[string]FieldError, len(v.Errors))
+
+	for key, message := range v.Errors {
+		code := v.Codes[key]
+		if code == "" {
+			code = CodeInvalid
+		}
+
+		details[key] = FieldError{Code: code, Message: message}
+	}
+
+	return details
+}
+
 func In(value string, list ...string) bool {
 	for i := range list {
 		if value == list[i] {
@@ -52,3 +101,14 @@ func Unique(values []string) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// NoBlanks reports whether none of the values is empty or only whitespace
+func NoBlanks(values []string) bool {
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			return false
+		}
+	}
+
+	return true
+}
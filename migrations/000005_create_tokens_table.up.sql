@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS tokens (
+    hash BYTEA PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry TIMESTAMP(0) with TIME ZONE NOT NULL,
+    scope TEXT NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS ratings (
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movie ON DELETE CASCADE,
+    score INTEGER NOT NULL CHECK (score BETWEEN 1 AND 10),
+    created_at TIMESTAMP(0) with TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id)
+);
\ No newline at end of file
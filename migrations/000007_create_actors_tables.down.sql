@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_actor;
+DROP TABLE IF EXISTS actor;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS actor (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) with TIME ZONE NOT NULL DEFAULT NOW(),
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS movie_actor (
+    movie_id BIGINT NOT NULL REFERENCES movie ON DELETE CASCADE,
+    actor_id BIGINT NOT NULL REFERENCES actor ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    PRIMARY KEY (movie_id, actor_id, role)
+);
\ No newline at end of file
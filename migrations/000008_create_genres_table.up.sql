@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS genres (
+    name TEXT PRIMARY KEY
+);
+
+INSERT INTO genres (name) VALUES
+    ('action'),
+    ('adventure'),
+    ('animation'),
+    ('biography'),
+    ('comedy'),
+    ('crime'),
+    ('documentary'),
+    ('drama'),
+    ('family'),
+    ('fantasy'),
+    ('history'),
+    ('horror'),
+    ('music'),
+    ('mystery'),
+    ('romance'),
+    ('sci-fi'),
+    ('sport'),
+    ('thriller'),
+    ('war'),
+    ('western')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE ratings DROP COLUMN IF EXISTS version;
\ No newline at end of file
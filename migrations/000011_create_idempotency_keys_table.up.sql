@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash BYTEA NOT NULL,
+    movie_id BIGINT NOT NULL,
+    expiry TIMESTAMP(0) with TIME ZONE NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE movie DROP COLUMN IF EXISTS poster_path;
\ No newline at end of file
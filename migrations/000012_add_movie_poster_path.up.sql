@@ -0,0 +1 @@
+ALTER TABLE movie ADD COLUMN IF NOT EXISTS poster_path TEXT;
\ No newline at end of file
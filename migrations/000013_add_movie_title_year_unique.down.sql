@@ -0,0 +1 @@
+ALTER TABLE movie DROP CONSTRAINT IF EXISTS movie_title_year_key;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Keep the oldest movie of each title and year, the duplicates get their id appended to the
+-- title so that no row is lost and the constraint can be added
+UPDATE movie SET title = movie.title || ' (' || movie.id || ')'
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY title, year ORDER BY id) AS position
+    FROM movie
+) AS duplicate
+WHERE movie.id = duplicate.id AND duplicate.position > 1;
+
+ALTER TABLE movie ADD CONSTRAINT movie_title_year_key UNIQUE (title, year);
\ No newline at end of file
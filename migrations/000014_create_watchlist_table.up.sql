@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS watchlist (
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movie ON DELETE CASCADE,
+    watched BOOLEAN NOT NULL DEFAULT false,
+    watched_at TIMESTAMP(0) with TIME ZONE,
+    PRIMARY KEY (user_id, movie_id)
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO permissions (code)
+VALUES ('admin:read')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movie_slug_idx;
+
+ALTER TABLE movie DROP COLUMN IF EXISTS slug;
\ No newline at end of file
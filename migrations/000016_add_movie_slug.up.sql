@@ -0,0 +1,17 @@
+ALTER TABLE movie ADD COLUMN IF NOT EXISTS slug text;
+
+WITH slugs AS (
+    SELECT id, base, row_number() OVER (PARTITION BY base ORDER BY id) AS n
+    FROM (
+        SELECT id, trim(both '-' from regexp_replace(lower(title) || ' ' || year, '[^a-z0-9]+', '-', 'g')) AS base
+        FROM movie
+    ) bases
+)
+UPDATE movie
+SET slug = CASE WHEN slugs.n = 1 THEN slugs.base ELSE slugs.base || '-' || slugs.n END
+FROM slugs
+WHERE movie.id = slugs.id;
+
+ALTER TABLE movie ALTER COLUMN slug SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_slug_idx ON movie (slug);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE movie DROP COLUMN IF EXISTS external_id;
\ No newline at end of file
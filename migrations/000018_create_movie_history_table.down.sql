@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS movie_history_trigger ON movie;
+
+DROP FUNCTION IF EXISTS record_movie_history();
+
+DROP TABLE IF EXISTS movie_history;
\ No newline at end of file
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS movie_history (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT NOT NULL,
+    version INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    year INTEGER NOT NULL,
+    runtime INTEGER NOT NULL,
+    genres TEXT[] NOT NULL,
+    operation TEXT NOT NULL,
+    changed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- No foreign key to movie, the history outlives the movie
+CREATE INDEX IF NOT EXISTS movie_history_movie_id_idx ON movie_history (movie_id, id);
+
+-- Every write path goes through the trigger, the row recorded is the movie before the change
+CREATE OR REPLACE FUNCTION record_movie_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR (OLD.title, OLD.year, OLD.runtime, OLD.genres) IS DISTINCT FROM (NEW.title, NEW.year, NEW.runtime, NEW.genres) THEN
+        INSERT INTO movie_history (movie_id, version, title, year, runtime, genres, operation)
+        VALUES (OLD.id, OLD.version, OLD.title, OLD.year, OLD.runtime, OLD.genres, lower(TG_OP));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movie_history_trigger
+AFTER UPDATE OR DELETE ON movie
+FOR EACH ROW EXECUTE FUNCTION record_movie_history();
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'admin:write';
\ No newline at end of file
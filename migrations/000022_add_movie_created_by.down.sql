@@ -0,0 +1 @@
+ALTER TABLE movie DROP COLUMN IF EXISTS created_by;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE movie ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movie_created_by_idx ON movie (created_by, id);
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- The keys created before they were scoped by user cannot be attributed to one, they
+-- only live for a day so they are dropped rather than migrated
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD COLUMN user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE;
+ALTER TABLE idempotency_keys ADD COLUMN response JSONB NOT NULL;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (user_id, key);
\ No newline at end of file